@@ -0,0 +1,439 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// agentRequest asks the agent for the credentials of a profile.
+type agentRequest struct {
+	Profile string `json:"Profile"`
+}
+
+// agentResponse carries the credentials, or why they could not be resolved.
+type agentResponse struct {
+	Creds *Creds `json:"Creds,omitempty"`
+	Error string `json:"Error,omitempty"`
+}
+
+// agentServer resolves profiles for the agent clients, one at a time per
+// profile, and refreshes their sessions ahead of time.
+type agentServer struct {
+	app      *app
+	timers   map[string]*time.Timer
+	profiles map[string]*sync.Mutex
+	mu       sync.Mutex
+}
+
+// cachingStore keeps the secrets read from (or written to) a Store in memory
+// for ttl, or until the stamp file changes. Sessions are never kept: they are
+// re-read under the refresh lock and deleted by logout.
+type cachingStore struct {
+	Store
+
+	entries map[[2]string]cachedSecret
+	stamp   string // The stamp file, nothing is kept if empty.
+	seen    string // Its content when the entries were read.
+	ttl     time.Duration
+	mu      sync.Mutex
+}
+
+// stampedStore rewrites the stamp file whenever its Store changes, so that
+// a running agent drops what it keeps in memory.
+type stampedStore struct {
+	Store
+
+	stamp string
+}
+
+type cachedSecret struct {
+	read   time.Time
+	secret string
+}
+
+const (
+	defaultAgentTTL     = 15 * time.Minute
+	defaultAgentTimeout = 10 * time.Second
+	agentSocketName     = "agent.sock"
+	agentRetryDelay     = 30 * time.Second
+	storeStampName      = "store.stamp"
+)
+
+var errNoAgent = errors.New("no agent running")
+
+// agent serves the credentials of the profiles over a Unix socket, to the
+// processes of the same user only, until interrupted. Profiles are kept in
+// memory for --ttl and role sessions are refreshed before they go stale.
+func (a *app) agent(ctx context.Context, w io.Writer, args []string) (err error) {
+	path, ttl := a.agentSocket(), cmp.Or(a.AwbusAgentTTL, defaultAgentTTL)
+
+	flags := flag.NewFlagSet("agent", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&path, "socket", path, "socket path")
+	flags.DurationVar(&ttl, "ttl", ttl, "how long profiles are kept in memory")
+
+	if err = flags.Parse(args); err != nil {
+		return fmt.Errorf("agent: %w", err)
+	}
+
+	if path == "" {
+		return errors.New("agent requires a socket path: set AWBUS_AGENT_SOCKET or pass --socket")
+	}
+
+	stop, err := a.startAgent(ctx, path, ttl)
+	if err != nil {
+		return
+	}
+	defer stop()
+
+	if _, err = fmt.Fprintln(w, envLine("dotenv", envVar{"AWBUS_AGENT_SOCKET", path})); err != nil {
+		return
+	}
+
+	waitForInterrupt(ctx)
+
+	return
+}
+
+// startAgent serves the agent socket at path, in the background, until
+// stopped. The socket is only accessible to the user and the credentials of
+// its peers are checked, too.
+func (a *app) startAgent(ctx context.Context, path string, ttl time.Duration) (stop func(), err error) {
+	if !peerCredentials {
+		return nil, fmt.Errorf("agent: not supported on %s", runtime.GOOS)
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), privateDirMode); err != nil {
+		return nil, fmt.Errorf("agent: %w", err)
+	}
+
+	if conn, derr := dialAgent(ctx, path); derr == nil {
+		conn.Close() //nolint:errcheck,gosec // ok
+
+		return nil, fmt.Errorf("agent: already running on %s", path)
+	}
+
+	os.Remove(path) //nolint:errcheck,gosec // A stale socket, if any.
+
+	ln, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("agent: %w", err)
+	}
+
+	if err = os.Chmod(path, privateFileMode); err != nil {
+		ln.Close() //nolint:errcheck,gosec // ok
+
+		return nil, fmt.Errorf("agent: %w", err)
+	}
+
+	ap := *a
+	ap.store = &cachingStore{Store: a.store, stamp: a.storeStamp(), ttl: ttl, entries: map[[2]string]cachedSecret{}}
+	ap.ttyPrompt = serialPrompt(a.ttyPrompt)
+	srv := newAgentServer(&ap)
+	ctx, cancel := context.WithCancel(ctx)
+
+	go srv.serve(ctx, ln)
+
+	return func() {
+		cancel()
+		ln.Close() //nolint:errcheck,gosec // ok
+		srv.stopTimers()
+	}, nil
+}
+
+func newAgentServer(a *app) *agentServer {
+	return &agentServer{app: a, timers: map[string]*time.Timer{}, profiles: map[string]*sync.Mutex{}}
+}
+
+// serialPrompt makes the profiles resolved concurrently prompt one at a
+// time, on the agent's terminal.
+func serialPrompt(prompt func(label string, val *string) error) func(label string, val *string) error {
+	var mu sync.Mutex
+
+	return func(label string, val *string) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return prompt(label, val)
+	}
+}
+
+func (s *agentServer) serve(ctx context.Context, ln *net.UnixListener) {
+	for {
+		conn, err := ln.AcceptUnix()
+		if err != nil {
+			return // Stopped.
+		}
+
+		go s.handle(ctx, conn)
+	}
+}
+
+// handle answers the request on conn.
+func (s *agentServer) handle(ctx context.Context, conn *net.UnixConn) {
+	defer conn.Close() //nolint:errcheck // ok
+
+	var resp agentResponse
+
+	if c, err := s.request(ctx, conn); err != nil {
+		resp.Error = err.Error()
+	} else {
+		resp.Creds = p(c.credentials())
+	}
+
+	json.MarshalWrite(conn, resp) //nolint:errcheck,gosec // The client is gone.
+}
+
+// request reads the request on conn, if it comes from the same user, and
+// resolves it.
+func (s *agentServer) request(ctx context.Context, conn *net.UnixConn) (c Creds, err error) {
+	conn.SetReadDeadline(time.Now().Add(serverTimeout)) //nolint:errcheck,gosec // ok
+
+	uid, err := peerUID(conn)
+	if err != nil || uid != os.Getuid() {
+		return c, errors.New("agent: permission denied")
+	}
+
+	var req agentRequest
+
+	if err = json.UnmarshalDecode(jsontext.NewDecoder(conn), &req); err != nil {
+		return c, fmt.Errorf("agent: %w", err)
+	}
+
+	return s.resolve(ctx, req.Profile)
+}
+
+// resolve resolves (refreshing, if needed) the profile and schedules its
+// next refresh for when its session goes stale, so clients never wait for
+// one. Failed refreshes are left to the next client, which gets the error.
+// Only requests for the same profile wait for each other, e.g. for an MFA
+// code.
+func (s *agentServer) resolve(ctx context.Context, name string) (c Creds, err error) {
+	mu := s.profileLock(name)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if c, err = s.app.resolveAndMaybeRefresh(ctx, name); err != nil || c.Expiration.IsZero() {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t := s.timers[name]; t != nil {
+		t.Stop()
+	}
+
+	stale := c.Expiration.Add(-cmp.Or(c.SkewPad, s.app.SkewPad))
+	s.timers[name] = time.AfterFunc(max(time.Until(stale), agentRetryDelay), func() {
+		s.resolve(ctx, name) //nolint:errcheck,gosec // Left to the next client.
+	})
+
+	return
+}
+
+func (s *agentServer) profileLock(name string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.profiles[name] == nil {
+		s.profiles[name] = &sync.Mutex{}
+	}
+
+	return s.profiles[name]
+}
+
+func (s *agentServer) stopTimers() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.timers {
+		t.Stop()
+	}
+}
+
+// agentSocket is the agent socket path: AWBUS_AGENT_SOCKET, else agent.sock
+// in the runtime directory; none if neither is known.
+func (a *app) agentSocket() string {
+	if a.AwbusAgentSocket != "" || a.lockDir == "" {
+		return a.AwbusAgentSocket
+	}
+
+	return filepath.Join(a.lockDir, agentSocketName)
+}
+
+// loadCreds resolves the profile through the agent when one is running (and
+// answers in time), else directly.
+func (a *app) loadCreds(ctx context.Context, name string) (c Creds, err error) {
+	if c, err = a.agentLoad(ctx, name); !errors.Is(err, errNoAgent) && !errors.Is(err, os.ErrDeadlineExceeded) {
+		return
+	}
+
+	return a.resolveAndMaybeRefresh(ctx, name)
+}
+
+// agentLoad asks the agent for the credentials of the profile, giving up
+// after AwbusAgentTimeout.
+func (a *app) agentLoad(ctx context.Context, name string) (c Creds, err error) {
+	path := a.agentSocket()
+	if path == "" {
+		return c, errNoAgent
+	}
+
+	timeout := cmp.Or(a.AwbusAgentTimeout, defaultAgentTimeout)
+
+	conn, err := (&net.Dialer{Timeout: timeout}).DialContext(ctx, "unix", path)
+	if err != nil {
+		return c, fmt.Errorf("%w: %w", errNoAgent, err)
+	}
+	defer conn.Close() //nolint:errcheck // ok
+
+	if err = conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return c, fmt.Errorf("agent: %w", err)
+	}
+
+	var resp agentResponse
+
+	if err = json.MarshalWrite(conn, agentRequest{name}); err != nil {
+		return c, fmt.Errorf("agent: %w", err)
+	}
+
+	if err = json.UnmarshalRead(conn, &resp); err != nil {
+		return c, fmt.Errorf("agent: %w", err)
+	}
+
+	if resp.Error != "" {
+		return c, errors.New(resp.Error)
+	}
+
+	if resp.Creds == nil {
+		return c, errors.New("agent: empty response")
+	}
+
+	return *resp.Creds, nil
+}
+
+func dialAgent(ctx context.Context, path string) (net.Conn, error) {
+	return (&net.Dialer{Timeout: defaultAgentTimeout}).DialContext(ctx, "unix", path)
+}
+
+// storeStamp is the stamp file path, in the runtime directory; none if that
+// is not known.
+func (a *app) storeStamp() string {
+	if a.lockDir == "" {
+		return ""
+	}
+
+	return filepath.Join(a.lockDir, storeStampName)
+}
+
+// stampStore makes the changes to st visible to a running agent.
+func (a *app) stampStore(st Store) Store { //nolint:ireturn // Any backend.
+	if a.lockDir == "" {
+		return st
+	}
+
+	return stampedStore{Store: st, stamp: a.storeStamp()}
+}
+
+func (s stampedStore) Set(service, username, secret string) (err error) {
+	if err = s.Store.Set(service, username, secret); err == nil {
+		s.touch()
+	}
+
+	return
+}
+
+func (s stampedStore) Delete(service, username string) (err error) {
+	if err = s.Store.Delete(service, username); err == nil {
+		s.touch()
+	}
+
+	return
+}
+
+// touch rewrites the stamp file, best effort: the agent still drops what it
+// keeps after its ttl.
+func (s stampedStore) touch() {
+	os.MkdirAll(filepath.Dir(s.stamp), privateDirMode) //nolint:errcheck,gosec // ok
+
+	stamp := strconv.FormatInt(time.Now().UnixNano(), 10)
+	os.WriteFile(s.stamp, []byte(stamp), privateFileMode) //nolint:errcheck,gosec // ok
+}
+
+func (s *cachingStore) Get(service, username string) (secret string, err error) {
+	key := [2]string{service, username}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.cached(service) {
+		return s.Store.Get(service, username)
+	}
+
+	if e, ok := s.entries[key]; ok && time.Since(e.read) < s.ttl {
+		return e.secret, nil
+	}
+
+	delete(s.entries, key)
+
+	if secret, err = s.Store.Get(service, username); err == nil {
+		s.entries[key] = cachedSecret{time.Now(), secret}
+	}
+
+	return
+}
+
+func (s *cachingStore) Set(service, username, secret string) (err error) {
+	key := [2]string{service, username}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, key)
+
+	if err = s.Store.Set(service, username, secret); err == nil && s.cached(service) {
+		s.entries[key] = cachedSecret{time.Now(), secret}
+	}
+
+	return
+}
+
+func (s *cachingStore) Delete(service, username string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.entries, [2]string{service, username})
+
+	return s.Store.Delete(service, username)
+}
+
+// cached tells whether the secrets of service are kept, dropping them all
+// when the stamp file changed.
+func (s *cachingStore) cached(service string) bool {
+	if s.stamp == "" || service == sessionService {
+		return false
+	}
+
+	stamp, _ := os.ReadFile(s.stamp) //nolint:errcheck // Missing until the first change.
+	if string(stamp) != s.seen {
+		clear(s.entries)
+		s.seen = string(stamp)
+	}
+
+	return true
+}
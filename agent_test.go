@@ -0,0 +1,275 @@
+//nolint:lll // ok
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestAppAgentLoad(t *testing.T) {
+	keyring.MockInit()
+	keyring.Set(keyringService, "static", `{"Version":1,"AccessKeyId":"AKIA","SecretAccessKey":"s"}`) //nolint:errcheck,gosec // ok
+
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "agent.sock")
+	startTestAgent(t, socket)
+
+	if _, err := (&app{}).startAgent(t.Context(), socket, time.Minute); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("startAgent() again error = %v", err)
+	}
+
+	cfg := config{AwbusPassphrase: "hunter2"}
+	st := newTestFileStore(t, &cfg)
+
+	if err := (&Creds{AccessKeyID: "LOCAL", SecretAccessKey: "s"}).store(st, "static"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		socket  string
+		profile string
+		want    string
+		wantErr string
+	}{
+		{name: "agent", socket: socket, profile: "static", want: "AKIA"},
+		{name: "agent error", socket: socket, profile: "nope", wantErr: "not found"},
+		{name: "no agent", socket: filepath.Join(dir, "none.sock"), profile: "static", want: "LOCAL"},
+		{name: "no socket", profile: "static", want: "LOCAL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg.AwbusAgentSocket = tt.socket
+			ap := app{store: st, config: cfg}
+
+			c, err := ap.loadCreds(t.Context(), tt.profile)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("loadCreds() error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil || c.AccessKeyID != tt.want || c.RoleArn != "" {
+				t.Errorf("loadCreds() = %+v, %v, want %s", c, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppAgentSeesStoreChanges(t *testing.T) {
+	keyring.MockInit()
+
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "agent.sock")
+	agent := app{store: keyringStore{}, config: config{SkewPad: time.Minute}, lockDir: dir}
+	writer := app{store: agent.stampStore(keyringStore{})}
+	client := app{config: config{AwbusAgentSocket: socket}}
+
+	if err := (&Creds{AccessKeyID: "OLD", SecretAccessKey: "s"}).store(writer.store, "static"); err != nil {
+		t.Fatal(err)
+	}
+
+	stop, err := agent.startAgent(t.Context(), socket, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	load := func(want string) {
+		t.Helper()
+
+		if c, lerr := client.agentLoad(t.Context(), "static"); want == "" && lerr == nil {
+			t.Errorf("agentLoad() = %+v, want not found", c)
+		} else if want != "" && (lerr != nil || c.AccessKeyID != want) {
+			t.Errorf("agentLoad() = %+v, %v, want %s", c, lerr, want)
+		}
+	}
+
+	load("OLD")
+
+	if err = (&Creds{AccessKeyID: "NEW", SecretAccessKey: "s"}).store(writer.store, "static"); err != nil {
+		t.Fatal(err)
+	}
+
+	load("NEW")
+
+	if err = writer.store.Delete(keyringService, "static"); err != nil {
+		t.Fatal(err)
+	}
+
+	load("")
+}
+
+func TestAppAgentLoadTimeout(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+
+	ln, err := (&net.ListenConfig{}).Listen(t.Context(), "unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close() //nolint:errcheck // ok
+
+	go func() {
+		if conn, aerr := ln.Accept(); aerr == nil {
+			defer conn.Close() //nolint:errcheck // ok
+
+			<-t.Context().Done() // Never answers.
+		}
+	}()
+
+	cfg := config{AwbusPassphrase: "hunter2", AwbusAgentSocket: socket, AwbusAgentTimeout: 100 * time.Millisecond}
+	st := newTestFileStore(t, &cfg)
+
+	if err = (&Creds{AccessKeyID: "LOCAL", SecretAccessKey: "s"}).store(st, "static"); err != nil {
+		t.Fatal(err)
+	}
+
+	ap := app{store: st, config: cfg}
+
+	if c, lerr := ap.loadCreds(t.Context(), "static"); lerr != nil || c.AccessKeyID != "LOCAL" {
+		t.Errorf("loadCreds() = %+v, %v, want LOCAL", c, lerr)
+	}
+}
+
+func startTestAgent(t *testing.T, socket string) {
+	t.Helper()
+
+	ap := app{store: keyringStore{}, config: config{SkewPad: time.Minute}}
+
+	stop, err := ap.startAgent(t.Context(), socket, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(stop)
+}
+
+func TestAppAgent(t *testing.T) {
+	ap := app{}
+
+	if err := ap.agent(t.Context(), io.Discard, nil); err == nil || !strings.Contains(err.Error(), "requires a socket path") {
+		t.Errorf("agent() error = %v", err)
+	}
+
+	if err := ap.agent(t.Context(), io.Discard, []string{"--ttl", "soon"}); err == nil {
+		t.Error("agent() bad --ttl error = nil")
+	}
+}
+
+func TestAgentServerSchedulesRefresh(t *testing.T) {
+	keyring.MockInit()
+
+	for name, c := range map[string]Creds{
+		"static": {AccessKeyID: "AKIA", SecretAccessKey: "s"},
+		"role": {
+			AccessKeyID: "ASIA", SecretAccessKey: "s", SessionToken: "t", Expiration: time.Now().Add(time.Hour),
+			RoleArn: "arn:aws:iam::123456789012:role/r", SourceProfile: "static",
+		},
+	} {
+		if err := c.store(keyringStore{}, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	srv := newAgentServer(&app{store: keyringStore{}, config: config{SkewPad: time.Minute}})
+	defer srv.stopTimers()
+
+	for _, name := range []string{"static", "role"} {
+		if _, err := srv.resolve(t.Context(), name); err != nil {
+			t.Fatalf("resolve(%s) error = %v", name, err)
+		}
+	}
+
+	if srv.timers["static"] != nil || srv.timers["role"] == nil {
+		t.Errorf("timers = %v, want one for role only", srv.timers)
+	}
+
+	busy := srv.profileLock("role") // E.g. waiting for an MFA code.
+	busy.Lock()
+
+	defer busy.Unlock()
+
+	done := make(chan error)
+
+	go func() {
+		_, err := srv.resolve(t.Context(), "static")
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("resolve(static) error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("resolve(static) waited for another profile")
+	}
+}
+
+func TestCachingStore(t *testing.T) {
+	keyring.MockInit()
+	keyring.Set("svc", "user", "old") //nolint:errcheck,gosec // ok
+
+	keyring.Set(sessionService, "user", "old") //nolint:errcheck,gosec // ok
+
+	writer := stampedStore{Store: keyringStore{}, stamp: filepath.Join(t.TempDir(), storeStampName)}
+	st := &cachingStore{Store: keyringStore{}, stamp: writer.stamp, ttl: time.Minute, entries: map[[2]string]cachedSecret{}}
+
+	for _, service := range []string{"svc", sessionService} {
+		if got, err := st.Get(service, "user"); err != nil || got != "old" {
+			t.Fatalf("Get(%s) = %q, %v", service, got, err)
+		}
+
+		keyring.Set(service, "user", "new") //nolint:errcheck,gosec // Not stamped.
+	}
+
+	if got, err := st.Get("svc", "user"); err != nil || got != "old" {
+		t.Errorf("Get() cached = %q, %v, want old", got, err)
+	}
+
+	if got, err := st.Get(sessionService, "user"); err != nil || got != "new" {
+		t.Errorf("Get() session = %q, %v, want new (never cached)", got, err)
+	}
+
+	if err := writer.Set("svc", "user", "stamped"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := st.Get("svc", "user"); err != nil || got != "stamped" {
+		t.Errorf("Get() after stamp = %q, %v, want stamped", got, err)
+	}
+
+	if err := st.Set("svc", "user", "newer"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, err := keyring.Get("svc", "user"); err != nil || got != "newer" {
+		t.Errorf("Set() did not write through: %q, %v", got, err)
+	}
+
+	st.ttl = 0
+
+	keyring.Set("svc", "user", "newest") //nolint:errcheck,gosec // ok
+
+	if got, err := st.Get("svc", "user"); err != nil || got != "newest" {
+		t.Errorf("Get() expired = %q, %v, want newest", got, err)
+	}
+
+	if err := st.Delete("svc", "user"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.Get("svc", "user"); !errors.Is(err, errNotFound) {
+		t.Errorf("Get() deleted error = %v", err)
+	}
+}
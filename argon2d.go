@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+	"sync"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// Argon2d (RFC 9106, version 0x13), the KeePassXC default KDF, which
+// golang.org/x/crypto/argon2 does not export (it only has Argon2i/Argon2id).
+
+type argon2Block [argon2BlockWords]uint64
+
+const (
+	argon2Version     = 0x13
+	argon2SyncPoints  = 4
+	argon2BlockWords  = 128
+	argon2BlockBytes  = argon2BlockWords * 8
+	argon2TypeD       = 0
+	argon2PrehashSize = blake2b.Size + 8
+)
+
+// argon2dKey derives keyLen bytes; memory is in KiB.
+func argon2dKey(password, salt, secret, data []byte, time, memory uint32, threads uint8, keyLen uint32) []byte {
+	lanes := uint32(threads)
+	h0 := argon2InitHash(password, salt, secret, data, time, memory, lanes, keyLen)
+
+	// H0 hashes the requested memory, the blocks use it rounded down.
+	memory = max(memory, 2*argon2SyncPoints*lanes) / (argon2SyncPoints * lanes) * (argon2SyncPoints * lanes)
+	laneLen := memory / lanes
+	segLen := laneLen / argon2SyncPoints
+	blocks := make([]argon2Block, memory)
+
+	var buf [argon2BlockBytes]byte
+
+	for lane := range lanes {
+		j := lane * laneLen
+
+		binary.LittleEndian.PutUint32(h0[blake2b.Size+4:], lane)
+
+		for i := range uint32(2) {
+			binary.LittleEndian.PutUint32(h0[blake2b.Size:], i)
+			argon2HashPrime(buf[:], h0[:])
+
+			for k := range blocks[j+i] {
+				blocks[j+i][k] = binary.LittleEndian.Uint64(buf[k*8:])
+			}
+		}
+	}
+
+	for pass := range time {
+		for slice := range uint32(argon2SyncPoints) {
+			var wg sync.WaitGroup
+
+			for lane := range lanes {
+				wg.Go(func() { argon2dSegment(blocks, pass, slice, lane, lanes, laneLen, segLen) })
+			}
+
+			wg.Wait()
+		}
+	}
+
+	final := blocks[laneLen-1]
+	for lane := uint32(1); lane < lanes; lane++ {
+		for k, w := range blocks[lane*laneLen+laneLen-1] {
+			final[k] ^= w
+		}
+	}
+
+	for k, w := range final {
+		binary.LittleEndian.PutUint64(buf[k*8:], w)
+	}
+
+	key := make([]byte, keyLen)
+	argon2HashPrime(key, buf[:])
+
+	return key
+}
+
+func argon2InitHash(password, salt, secret, data []byte, time, memory, lanes, keyLen uint32,
+) (h0 [argon2PrehashSize]byte) {
+	b2, _ := blake2b.New512(nil) //nolint:errcheck // Only fails for long keys.
+
+	var params [24]byte
+
+	binary.LittleEndian.PutUint32(params[0:], lanes)
+	binary.LittleEndian.PutUint32(params[4:], keyLen)
+	binary.LittleEndian.PutUint32(params[8:], memory)
+	binary.LittleEndian.PutUint32(params[12:], time)
+	binary.LittleEndian.PutUint32(params[16:], argon2Version)
+	binary.LittleEndian.PutUint32(params[20:], argon2TypeD)
+	b2.Write(params[:])
+
+	for _, v := range [][]byte{password, salt, secret, data} {
+		writeLen32(b2, len(v))
+		b2.Write(v)
+	}
+
+	b2.Sum(h0[:0])
+
+	return
+}
+
+func writeLen32(h hash.Hash, n int) {
+	var b [4]byte
+
+	binary.LittleEndian.PutUint32(b[:], uint32(n)) //nolint:gosec // ok
+	h.Write(b[:])
+}
+
+// argon2HashPrime is the variable length hash H' of RFC 9106, 3.3.
+func argon2HashPrime(out, in []byte) {
+	if len(out) <= blake2b.Size {
+		b2, _ := blake2b.New(len(out), nil) //nolint:errcheck // Valid size.
+		writeLen32(b2, len(out))
+		b2.Write(in)
+		b2.Sum(out[:0])
+
+		return
+	}
+
+	b2, _ := blake2b.New512(nil) //nolint:errcheck // ok
+	writeLen32(b2, len(out))
+	b2.Write(in)
+
+	var v [blake2b.Size]byte
+
+	b2.Sum(v[:0])
+
+	n := copy(out, v[:blake2b.Size/2])
+	for len(out)-n > blake2b.Size {
+		v = blake2b.Sum512(v[:])
+		n += copy(out[n:], v[:blake2b.Size/2])
+	}
+
+	b2, _ = blake2b.New(len(out)-n, nil) //nolint:errcheck // Valid size.
+	b2.Write(v[:])
+	b2.Sum(out[n:n])
+}
+
+func argon2dSegment(blocks []argon2Block, pass, slice, lane, lanes, laneLen, segLen uint32) {
+	start := uint32(0)
+	if pass == 0 && slice == 0 {
+		start = 2 // The first two blocks are already set.
+	}
+
+	offset := lane*laneLen + slice*segLen + start
+
+	for index := start; index < segLen; index, offset = index+1, offset+1 {
+		prev := offset - 1
+		if offset%laneLen == 0 {
+			prev = offset + laneLen - 1
+		}
+
+		rand := blocks[prev][0]
+
+		refLane := uint32(rand>>32) % lanes //nolint:gosec,mnd // High half of J1||J2.
+		if pass == 0 && slice == 0 {
+			refLane = lane
+		}
+
+		ref := argon2RefIndex(uint32(rand), pass, slice, index, refLane == lane, laneLen, segLen) //nolint:gosec // ok
+
+		argon2Compress(&blocks[offset], &blocks[prev], &blocks[refLane*laneLen+ref], pass > 0)
+	}
+}
+
+// argon2RefIndex maps the pseudo random j1 to a block of the reference lane.
+func argon2RefIndex(j1, pass, slice, index uint32, sameLane bool, laneLen, segLen uint32) uint32 {
+	var area, startPos uint32
+
+	switch {
+	case pass == 0 && sameLane:
+		area = slice*segLen + index - 1
+	case pass == 0:
+		area = slice * segLen
+	case sameLane:
+		area = laneLen - segLen + index - 1
+	default:
+		area = laneLen - segLen
+	}
+
+	if !sameLane && index == 0 {
+		area--
+	}
+
+	if pass > 0 && slice != argon2SyncPoints-1 {
+		startPos = (slice + 1) * segLen
+	}
+
+	x := uint64(j1) * uint64(j1) >> 32 //nolint:mnd // RFC 9106, 3.4.2.
+	y := uint64(area) * x >> 32        //nolint:mnd // ok
+
+	return uint32((uint64(startPos) + uint64(area) - 1 - y) % uint64(laneLen)) //nolint:gosec // ok
+}
+
+// argon2Compress is the compression function G; with xor (passes after the
+// first, version 0x13) the result is XORed into out instead of replacing it.
+//
+//nolint:mnd // Word indices of the rows and columns.
+func argon2Compress(out, x, y *argon2Block, xor bool) {
+	var r, z argon2Block
+
+	for i := range r {
+		r[i] = x[i] ^ y[i]
+	}
+
+	z = r
+
+	for i := 0; i < argon2BlockWords; i += 16 {
+		argon2Blamka(&z, i, i+1, i+2, i+3, i+4, i+5, i+6, i+7, i+8, i+9, i+10, i+11, i+12, i+13, i+14, i+15)
+	}
+
+	for i := 0; i < 16; i += 2 {
+		argon2Blamka(&z, i, i+1, 16+i, 16+i+1, 32+i, 32+i+1, 48+i, 48+i+1,
+			64+i, 64+i+1, 80+i, 80+i+1, 96+i, 96+i+1, 112+i, 112+i+1)
+	}
+
+	for i := range out {
+		if xor {
+			out[i] ^= z[i] ^ r[i]
+		} else {
+			out[i] = z[i] ^ r[i]
+		}
+	}
+}
+
+// argon2Blamka is the permutation P over 16 words of b.
+func argon2Blamka(b *argon2Block, v0, v1, v2, v3, v4, v5, v6, v7, v8, v9, v10, v11, v12, v13, v14, v15 int) {
+	argon2GB(b, v0, v4, v8, v12)
+	argon2GB(b, v1, v5, v9, v13)
+	argon2GB(b, v2, v6, v10, v14)
+	argon2GB(b, v3, v7, v11, v15)
+	argon2GB(b, v0, v5, v10, v15)
+	argon2GB(b, v1, v6, v11, v12)
+	argon2GB(b, v2, v7, v8, v13)
+	argon2GB(b, v3, v4, v9, v14)
+}
+
+func argon2GB(blk *argon2Block, a, b, c, d int) {
+	fBlaMka := func(x, y uint64) uint64 {
+		return x + y + 2*(x&0xffffffff)*(y&0xffffffff) //nolint:mnd // ok
+	}
+
+	blk[a] = fBlaMka(blk[a], blk[b])
+	blk[d] = bits.RotateLeft64(blk[d]^blk[a], -32)
+	blk[c] = fBlaMka(blk[c], blk[d])
+	blk[b] = bits.RotateLeft64(blk[b]^blk[c], -24)
+	blk[a] = fBlaMka(blk[a], blk[b])
+	blk[d] = bits.RotateLeft64(blk[d]^blk[a], -16)
+	blk[c] = fBlaMka(blk[c], blk[d])
+	blk[b] = bits.RotateLeft64(blk[b]^blk[c], -63)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestArgon2dKey(t *testing.T) {
+	pw, salt := []byte("password"), []byte("somesalt")
+
+	// Vectors from golang.org/x/crypto/argon2, generated with the reference CLI.
+	tests := []struct {
+		name         string
+		want         string
+		password     []byte
+		salt         []byte
+		secret       []byte
+		data         []byte
+		time, memory uint32
+		threads      uint8
+	}{
+		{
+			name: "rfc 9106", want: "512b391b6f1162975371d30919734294f868e3be3984f3c1a13a4db9fabe4acb",
+			password: bytes.Repeat([]byte{1}, 32), salt: bytes.Repeat([]byte{2}, 16),
+			secret: bytes.Repeat([]byte{3}, 8), data: bytes.Repeat([]byte{4}, 12),
+			time: 3, memory: 32, threads: 4,
+		},
+		{name: "t1 m64 p1", want: "8727405fd07c32c78d64f547f24150d3f2e703a89f981a19", time: 1, memory: 64, threads: 1},
+		{name: "t2 m64 p1", want: "3be9ec79a69b75d3752acb59a1fbb8b295a46529c48fbb75", time: 2, memory: 64, threads: 1},
+		{name: "t2 m64 p2", want: "68e2462c98b8bc6bb60ec68db418ae2c9ed24fc6748a40e9", time: 2, memory: 64, threads: 2},
+		{name: "t3 m256 p2", want: "f4f0669218eaf3641f39cc97efb915721102f4b128211ef2", time: 3, memory: 256, threads: 2},
+		{name: "t4 m4096 p4", want: "935598181aa8dc2b720914aa6435ac8d3e3a4210c5b0fb2d", time: 4, memory: 4096, threads: 4},
+		{name: "t4 m1024 p8", want: "83604fc2ad0589b9d055578f4d3cc55bc616df3578a896e9", time: 4, memory: 1024, threads: 8},
+		{name: "t2 m64 p3", want: "22474a423bda2ccd36ec9afd5119e5c8949798cadf659f51", time: 2, memory: 64, threads: 3},
+		{name: "t3 m1024 p6", want: "a3351b0319a53229152023d9206902f4ef59661cdca89481", time: 3, memory: 1024, threads: 6},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.password == nil {
+				tt.password, tt.salt = pw, salt
+			}
+
+			want, _ := hex.DecodeString(tt.want) //nolint:errcheck // ok
+
+			keyLen := uint32(len(want)) //nolint:gosec // ok
+
+			got := argon2dKey(tt.password, tt.salt, tt.secret, tt.data, tt.time, tt.memory, tt.threads, keyLen)
+			if !bytes.Equal(got, want) {
+				t.Errorf("argon2dKey() = %x, want %x", got, want)
+			}
+		})
+	}
+}
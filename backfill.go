@@ -0,0 +1,121 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json/v2"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+// indexBackfilled marks, in the index service, that the profiles stored
+// before the index existed were added to it.
+const indexBackfilled = keyringService + "-backfilled"
+
+// backfillIndex adds the profiles stored by versions of awbus that predate
+// the keyring index to it, best effort, for the commands listing them.
+func (a *app) backfillIndex(st Store) {
+	if s, ok := st.(stampedStore); ok {
+		st = s.Store
+	}
+
+	if ks, ok := st.(keyringStore); ok {
+		ks.backfillIndex(a.awsProfileNames) //nolint:errcheck,gosec // Like the index itself.
+	}
+}
+
+// backfillIndex adds the profiles stored by versions of awbus that predate
+// the index to it, once. The keyring cannot be enumerated, so it looks up
+// the names given and the source profiles of the ones it finds.
+func (ks keyringStore) backfillIndex(profileNames func() []string) (err error) {
+	if _, err = keyring.Get(indexService, indexBackfilled); !errors.Is(err, keyring.ErrNotFound) {
+		return
+	}
+
+	indexed, err := ks.List(keyringService)
+	if err != nil {
+		return
+	}
+
+	var found []string
+
+	names := append(slices.Clone(indexed), profileNames()...)
+
+	for i := 0; i < len(names); i++ {
+		raw, gerr := keyring.Get(keyringService, names[i])
+		if errors.Is(gerr, keyring.ErrNotFound) {
+			continue
+		} else if gerr != nil {
+			return gerr
+		}
+
+		if !slices.Contains(indexed, names[i]) && !slices.Contains(found, names[i]) {
+			found = append(found, names[i])
+		}
+
+		var c struct {
+			SourceProfile string `json:"SourceProfile"`
+		}
+
+		if json.Unmarshal([]byte(raw), &c) == nil && c.SourceProfile != "" && !slices.Contains(names, c.SourceProfile) {
+			names = append(names, c.SourceProfile)
+		}
+	}
+
+	err = ks.updateIndex(keyringService, func(names []string) []string {
+		for _, name := range found {
+			if !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+
+		return names
+	})
+	if err != nil {
+		return
+	}
+
+	return keyring.Set(indexService, indexBackfilled, "true")
+}
+
+// awsProfileNames are the profiles named in the AWS shared config and
+// credentials files, and AWS_PROFILE: the ones awbus may be serving.
+func (a *app) awsProfileNames() (names []string) {
+	names = append(names, cmp.Or(a.AWSProfile, defaultProfileName))
+
+	home, _ := os.UserHomeDir() //nolint:errcheck // The files are then not found.
+
+	for _, f := range []struct{ path, prefix string }{
+		{cmp.Or(a.AWSConfigFile, filepath.Join(home, ".aws", "config")), "profile "},
+		{cmp.Or(a.AWSSharedCredentialsFile, filepath.Join(home, ".aws", "credentials")), ""},
+	} {
+		raw, err := os.ReadFile(f.path)
+		if err != nil {
+			continue
+		}
+
+		for line := range strings.Lines(string(raw)) {
+			if line = strings.TrimSpace(line); !strings.HasPrefix(line, "[") || !strings.HasSuffix(line, "]") {
+				continue
+			}
+
+			section := strings.TrimSpace(line[1 : len(line)-1])
+
+			if rest, ok := strings.CutPrefix(section, f.prefix); ok {
+				section = rest
+			} else if section != defaultProfileName {
+				continue // E.g. an sso-session.
+			}
+
+			if section = strings.TrimSpace(section); !slices.Contains(names, section) {
+				names = append(names, section)
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestKeyringStoreBackfillIndex(t *testing.T) {
+	keyring.MockInit()
+
+	for name, secret := range map[string]string{ // As stored before the index.
+		"default": `{"AccessKeyId":"AKIA","SecretAccessKey":"s"}`,
+		"base":    `{"AccessKeyId":"AKIA","SecretAccessKey":"s"}`,
+		"role":    `{"RoleArn":"arn:aws:iam::123456789012:role/r","SourceProfile":"base"}`,
+		"orphan":  `{"AccessKeyId":"AKIA","SecretAccessKey":"s"}`,
+	} {
+		keyring.Set(keyringService, name, secret) //nolint:errcheck,gosec // ok
+	}
+
+	ks := keyringStore{}
+
+	if err := ks.Set(keyringService, "new", `{"Version":2}`); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ks.backfillIndex(func() []string { return []string{"default", "role", "missing"} }); err != nil {
+		t.Fatalf("backfillIndex() error = %v", err)
+	}
+
+	want := []string{"base", "default", "new", "role"}
+	if got, err := ks.List(keyringService); err != nil || !slices.Equal(got, want) {
+		t.Errorf("List() = %v, %v, want %v", got, err, want)
+	}
+
+	err := ks.backfillIndex(func() []string {
+		t.Error("profile names collected again")
+		return []string{"orphan"}
+	})
+	if err != nil {
+		t.Fatalf("backfillIndex() again error = %v", err)
+	}
+
+	if got, lerr := ks.List(keyringService); lerr != nil || !slices.Equal(got, want) {
+		t.Errorf("List() after backfilling again = %v, %v, want %v (once only)", got, lerr, want)
+	}
+}
+
+func TestAppAWSProfileNames(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config{
+		AWSProfile:               "env",
+		AWSConfigFile:            filepath.Join(dir, "config"),
+		AWSSharedCredentialsFile: filepath.Join(dir, "credentials"),
+	}
+
+	os.WriteFile(cfg.AWSConfigFile, []byte("[default]\nregion = eu-west-1\n[profile prod]\n"+ //nolint:errcheck,gosec // ok
+		"credential_process = awbus\n[sso-session corp]\n[ profile  dev ]\n"), 0o600)
+	os.WriteFile(cfg.AWSSharedCredentialsFile, []byte("[ci]\n[prod]\n"), 0o600) //nolint:errcheck,gosec // ok
+
+	want := []string{"env", "default", "prod", "dev", "ci"}
+	if got := (&app{config: cfg}).awsProfileNames(); !slices.Equal(got, want) {
+		t.Errorf("awsProfileNames() = %v, want %v", got, want)
+	}
+}
+
+func TestAppBackfillIndexLazily(t *testing.T) {
+	keyring.MockInit()
+	keyring.Set(keyringService, "old", `{"AccessKeyId":"AKIA","SecretAccessKey":"s"}`) //nolint:errcheck,gosec // No index.
+
+	cfg := config{AWSProfile: "old", AWSConfigFile: "/nonexistent", AWSSharedCredentialsFile: "/nonexistent"}
+	ap := app{config: cfg}
+
+	st, err := ap.newStore(backendKeyring)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = keyring.Get(indexService, indexBackfilled); !errors.Is(err, keyring.ErrNotFound) {
+		t.Errorf("newStore() backfilled the index: %v", err)
+	}
+
+	ap.store = st
+	out := &bytes.Buffer{}
+
+	if err = ap.list(out, nil, time.Now()); err != nil || !strings.Contains(out.String(), "old") {
+		t.Errorf("list() = %q, %v, want the old profile", out, err)
+	}
+}
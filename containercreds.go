@@ -0,0 +1,85 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"crypto/subtle"
+	"encoding/json/v2"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// containerCredentials is the response of the ECS container credentials
+// endpoint (AWS_CONTAINER_CREDENTIALS_FULL_URI).
+type containerCredentials struct { //nolint:govet // ok
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token,omitempty"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// containerCredentialsError is the error response SDKs report.
+//
+//nolint:tagliatelle // ECS API.
+type containerCredentialsError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// staticCredentialsTTL is the expiration reported for static credentials,
+// which have none, as some SDKs (e.g. botocore) require one; they are simply
+// fetched again.
+const staticCredentialsTTL = 15 * time.Minute
+
+// containerCredentialsHandler serves the credentials of profile, resolved
+// (refreshing, if needed) on each request, to callers presenting token in
+// the Authorization header.
+func (a *app) containerCredentialsHandler(profile, token string) http.Handler {
+	resolve := a.serialResolver(profile)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(token)) != 1 {
+			replyJSON(w, http.StatusUnauthorized, containerCredentialsError{"AccessDenied", "invalid authorization token"})
+			return
+		}
+
+		c, err := resolve(r.Context())
+		if err != nil {
+			replyJSON(w, http.StatusInternalServerError, containerCredentialsError{"CredentialsError", err.Error()})
+			return
+		}
+
+		replyJSON(w, http.StatusOK, containerCredentials{
+			AccessKeyID:     c.AccessKeyID,
+			SecretAccessKey: c.SecretAccessKey,
+			Token:           c.SessionToken,
+			Expiration:      c.servedExpiration(),
+		})
+	})
+}
+
+// serialResolver resolves (refreshing, if needed) profile, one call at a
+// time, so concurrent requests refresh the session only once.
+func (a *app) serialResolver(profile string) func(context.Context) (Creds, error) {
+	var mu sync.Mutex
+
+	return func(ctx context.Context) (Creds, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return a.resolveAndMaybeRefresh(ctx, profile)
+	}
+}
+
+// servedExpiration is the expiration of the session or, for static
+// credentials, staticCredentialsTTL from now.
+func (c *Creds) servedExpiration() time.Time {
+	return cmp.Or(c.Expiration, time.Now().Add(staticCredentialsTTL)).UTC()
+}
+
+func replyJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.MarshalWrite(w, body) //nolint:errcheck,gosec // The client is gone.
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// credsMigration upgrades a stored profile, as the members of its JSON
+// object, to the next version. It may store other records of the profile.
+type credsMigration func(st Store, name string, fields map[string]jsontext.Value) error
+
+// credsVersion is the version of the stored Creds JSON:
+//
+//  1. Role sessions are kept with the role configuration.
+//  2. Role sessions are kept in the session cache (sessionService).
+const credsVersion = 2
+
+// storedVersion is the Version of a stored Creds JSON; records written
+// before it was set are version 1.
+func storedVersion(raw string) (int, error) {
+	var v struct {
+		Version int `json:"Version"`
+	}
+
+	if raw == "" {
+		return 0, errors.New("empty JSON")
+	}
+
+	if err := json.Unmarshal([]byte(raw), &v); err != nil {
+		return 0, err
+	}
+
+	return max(v.Version, 1), nil
+}
+
+// upgradeCreds upgrades the stored profile raw, of an older version, to
+// credsVersion, one version at a time; others are left to decode.
+func upgradeCreds(st Store, name, raw string) (_ string, err error) {
+	version, err := storedVersion(raw)
+	if err != nil {
+		return "", fmt.Errorf("profile %q: %w", name, err)
+	}
+
+	if version >= credsVersion {
+		return raw, nil
+	}
+
+	var fields map[string]jsontext.Value
+
+	if err = json.Unmarshal([]byte(raw), &fields); err != nil {
+		return
+	}
+
+	for ; version < credsVersion; version++ {
+		if err = migrationFrom(version)(st, name, fields); err != nil {
+			return "", fmt.Errorf("profile %q: upgrade from version %d: %w", name, version, err)
+		}
+	}
+
+	fields["Version"] = jsontext.Value(strconv.Itoa(credsVersion))
+
+	b, err := json.Marshal(fields, json.Deterministic(true))
+
+	return string(b), err
+}
+
+// migrationFrom is the migration from version to the next one.
+func migrationFrom(version int) credsMigration {
+	switch version {
+	case 1:
+		return moveSession
+	default:
+		return func(Store, string, map[string]jsontext.Value) error {
+			return fmt.Errorf("no migration from version %d", version)
+		}
+	}
+}
+
+// moveSession moves the session of role profiles to the session cache.
+func moveSession(st Store, name string, fields map[string]jsontext.Value) (err error) {
+	if fields["RoleArn"] == nil && fields["SsoStartUrl"] == nil {
+		return // Static, the keys are its configuration.
+	}
+
+	session := map[string]jsontext.Value{}
+
+	for _, k := range []string{"AccessKeyId", "SecretAccessKey", "SessionToken", "Expiration"} {
+		if v, ok := fields[k]; ok {
+			session[k] = v
+			delete(fields, k)
+		}
+	}
+
+	if len(session) == 0 {
+		return
+	}
+
+	var c Creds
+
+	b, err := json.Marshal(session)
+	if err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(b, &c); err != nil {
+		return
+	}
+
+	return c.storeSession(st, name)
+}
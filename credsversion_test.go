@@ -0,0 +1,109 @@
+package main
+
+import (
+	"cmp"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestCredsLoadUpgrade(t *testing.T) { //nolint:funlen // ok
+	const roleSession = `"AccessKeyId":"ASIA","SecretAccessKey":"s","SessionToken":"t","Expiration":"2025-01-15T10:00:00Z"`
+
+	tests := []struct {
+		name        string
+		stored      string
+		wantStored  string // Empty if left as it was.
+		wantSession string
+		wantErr     string
+	}{
+		{
+			name:       "1 static",
+			stored:     `{"Version":1,"AccessKeyId":"AKIA","SecretAccessKey":"s","UseSessionToken":true}`,
+			wantStored: `{"Version":2,"AccessKeyId":"AKIA","SecretAccessKey":"s","UseSessionToken":true}`,
+		},
+		{
+			name:        "1 role with session",
+			stored:      `{"Version":1,` + roleSession + `,"RoleArn":"arn:role","SourceProfile":"base","SkewPad":"5m"}`,
+			wantStored:  `{"Version":2,"RoleArn":"arn:role","SourceProfile":"base","SkewPad":"5m0s"}`,
+			wantSession: `{"Version":2,` + roleSession + `}`,
+		},
+		{
+			name:       "1 role without session",
+			stored:     `{"Version":1,"RoleArn":"arn:role","SourceProfile":"base"}`,
+			wantStored: `{"Version":2,"RoleArn":"arn:role","SourceProfile":"base"}`,
+		},
+		{
+			name:        "unversioned sso with session",
+			stored:      `{` + roleSession + `,"SsoStartUrl":"https://x.awsapps.com/start","SsoRoleName":"Admin"}`,
+			wantStored:  `{"Version":2,"SsoStartUrl":"https://x.awsapps.com/start","SsoRoleName":"Admin"}`,
+			wantSession: `{"Version":2,` + roleSession + `}`,
+		},
+		{
+			name:   "2",
+			stored: `{"Version":2,"RoleArn":"arn:role","SourceProfile":"base"}`,
+		},
+		{
+			name:    "newer",
+			stored:  `{"Version":3,"RoleArn":"arn:role","SourceProfile":"base","Shiny":true}`,
+			wantErr: "stored by a newer awbus (version 3",
+		},
+		{
+			name:    "unknown field",
+			stored:  `{"Version":2,"RoleArn":"arn:role","Shiny":true}`,
+			wantErr: `unknown object member name "Shiny"`,
+		},
+		{
+			name:    "invalid version",
+			stored:  `{"Version":"one"}`,
+			wantErr: `profile "p"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+
+			st := keyringStore{}
+			st.Set(keyringService, "p", tt.stored) //nolint:errcheck,gosec // ok
+
+			var c Creds
+
+			err := c.load(st, "p")
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("load() error = %v, want %q", err, tt.wantErr)
+				}
+
+				if got, _ := st.Get(keyringService, "p"); got != tt.stored { //nolint:errcheck // ok
+					t.Errorf("stored = %s, want it left as %s", got, tt.stored)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("load() error = %v", err)
+			}
+
+			if c.Version != credsVersion {
+				t.Errorf("load() Version = %d, want %d", c.Version, credsVersion)
+			}
+
+			if got, _ := st.Get(keyringService, "p"); got != cmp.Or(tt.wantStored, tt.stored) { //nolint:errcheck // ok
+				t.Errorf("stored = %s, want %s", got, cmp.Or(tt.wantStored, tt.stored))
+			}
+
+			if got, _ := st.Get(sessionService, "p"); got != tt.wantSession { //nolint:errcheck // ok
+				t.Errorf("session = %s, want %s", got, tt.wantSession)
+			}
+		})
+	}
+}
+
+func TestUpgradeCredsMissingMigration(t *testing.T) {
+	if err := migrationFrom(credsVersion)(keyringStore{}, "p", nil); err == nil {
+		t.Error("migrationFrom(credsVersion) error = nil")
+	}
+}
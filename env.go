@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// envVar is an environment variable to export; an empty value unsets it, so
+// no stale session token is left behind.
+type envVar struct {
+	name  string
+	value string
+}
+
+const (
+	defaultEnvFormat = "bash"
+	envFormatNames   = "bash|zsh|fish|powershell|dotenv|json"
+)
+
+// dotenvSafeRe matches values that need no quoting in any .env dialect
+// (docker --env-file takes values verbatim).
+var dotenvSafeRe = regexp.MustCompile(`^[\w+/=:.@-]*$`)
+
+// env prints the credentials of the named (else the current) profile as
+// environment variables, for tools that do not support credential_process.
+func (a *app) env(ctx context.Context, w io.Writer, args []string) (err error) {
+	name, format := a.AWSProfile, defaultEnvFormat
+
+	flags := flag.NewFlagSet("env", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&format, "format", format, "output format")
+
+	// The profile may come before or after the flags.
+	if err = flags.Parse(args); err == nil && flags.NArg() > 0 {
+		name = flags.Arg(0)
+		err = flags.Parse(flags.Args()[1:])
+	}
+
+	if err != nil {
+		return fmt.Errorf("env: %w", err)
+	}
+
+	if flags.NArg() > 0 {
+		return fmt.Errorf("env: unexpected arguments %q", flags.Args())
+	}
+
+	if !slices.Contains(strings.Split(envFormatNames, "|"), format) {
+		return fmt.Errorf("env: unknown format %q, want %s", format, envFormatNames)
+	}
+
+	c, err := a.resolveAndMaybeRefresh(ctx, name)
+	if err != nil {
+		return
+	}
+
+	vars := c.envVars(a.AWSRegion)
+
+	if format == "json" {
+		obj := map[string]string{}
+
+		for _, v := range vars {
+			if v.value != "" {
+				obj[v.name] = v.value
+			}
+		}
+
+		return json.MarshalWrite(w, obj, json.Deterministic(true), jsontext.WithIndent("  "))
+	}
+
+	var out strings.Builder
+
+	for _, v := range vars {
+		if v.value != "" || format != "dotenv" {
+			out.WriteString(envLine(format, v) + "\n")
+		}
+	}
+
+	_, err = io.WriteString(w, out.String())
+
+	return
+}
+
+func (c *Creds) envVars(region string) []envVar {
+	var expiration string
+
+	if !c.Expiration.IsZero() {
+		expiration = c.Expiration.UTC().Format(time.RFC3339)
+	}
+
+	return []envVar{
+		{"AWS_ACCESS_KEY_ID", c.AccessKeyID},
+		{"AWS_SECRET_ACCESS_KEY", c.SecretAccessKey},
+		{"AWS_SESSION_TOKEN", c.SessionToken},
+		{"AWS_CREDENTIAL_EXPIRATION", expiration},
+		{"AWS_REGION", region},
+		{"AWS_DEFAULT_REGION", region},
+	}
+}
+
+// envLine renders v in the format's syntax, quoting the value.
+func envLine(format string, v envVar) string {
+	switch format {
+	case "fish":
+		if v.value == "" {
+			return "set -e " + v.name
+		}
+
+		return "set -gx " + v.name + " '" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(v.value) + "'"
+	case "powershell":
+		if v.value == "" {
+			return "Remove-Item Env:" + v.name + " -ErrorAction SilentlyContinue"
+		}
+
+		return "$env:" + v.name + " = '" + strings.ReplaceAll(v.value, "'", "''") + "'"
+	case "dotenv":
+		if dotenvSafeRe.MatchString(v.value) {
+			return v.name + "=" + v.value
+		}
+
+		return v.name + `="` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "$", `\$`).Replace(v.value) + `"`
+	default:
+		if v.value == "" {
+			return "unset " + v.name
+		}
+
+		return "export " + v.name + "='" + strings.ReplaceAll(v.value, "'", `'\''`) + "'"
+	}
+}
@@ -0,0 +1,115 @@
+//nolint:lll // ok
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestAppEnv(t *testing.T) { //nolint:funlen // ok
+	tests := []struct {
+		name    string
+		want    string
+		wantErr string
+		args    []string
+	}{
+		{
+			name: "default bash",
+			want: `export AWS_ACCESS_KEY_ID='ASIA'
+export AWS_SECRET_ACCESS_KEY='it'\''s "$x"\n'
+export AWS_SESSION_TOKEN='tok'
+export AWS_CREDENTIAL_EXPIRATION='2099-01-15T10:30:00Z'
+export AWS_REGION='eu-west-1'
+export AWS_DEFAULT_REGION='eu-west-1'
+`,
+		},
+		{
+			name: "static zsh",
+			args: []string{"static", "--format=zsh"},
+			want: `export AWS_ACCESS_KEY_ID='AKIA'
+export AWS_SECRET_ACCESS_KEY='s'
+unset AWS_SESSION_TOKEN
+unset AWS_CREDENTIAL_EXPIRATION
+export AWS_REGION='eu-west-1'
+export AWS_DEFAULT_REGION='eu-west-1'
+`,
+		},
+		{
+			name: "fish",
+			args: []string{"--format", "fish", "static"},
+			want: `set -gx AWS_ACCESS_KEY_ID 'AKIA'
+set -gx AWS_SECRET_ACCESS_KEY 's'
+set -e AWS_SESSION_TOKEN
+set -e AWS_CREDENTIAL_EXPIRATION
+`,
+		},
+		{
+			name: "fish quoting",
+			args: []string{"--format=fish"},
+			want: `set -gx AWS_SECRET_ACCESS_KEY 'it\'s "$x"\\n'`,
+		},
+		{
+			name: "powershell",
+			args: []string{"--format=powershell"},
+			want: `$env:AWS_SECRET_ACCESS_KEY = 'it''s "$x"\n'
+$env:AWS_SESSION_TOKEN = 'tok'`,
+		},
+		{
+			name: "powershell unset",
+			args: []string{"--format=powershell", "static"},
+			want: "Remove-Item Env:AWS_SESSION_TOKEN -ErrorAction SilentlyContinue\n",
+		},
+		{
+			name: "dotenv",
+			args: []string{"--format=dotenv"},
+			want: `AWS_ACCESS_KEY_ID=ASIA
+AWS_SECRET_ACCESS_KEY="it's \"\$x\"\\n"
+AWS_SESSION_TOKEN=tok
+AWS_CREDENTIAL_EXPIRATION=2099-01-15T10:30:00Z
+`,
+		},
+		{
+			name: "json",
+			args: []string{"--format=json", "static"},
+			want: `{
+  "AWS_ACCESS_KEY_ID": "AKIA",
+  "AWS_DEFAULT_REGION": "eu-west-1",
+  "AWS_REGION": "eu-west-1",
+  "AWS_SECRET_ACCESS_KEY": "s"
+}`,
+		},
+		{name: "unknown format", args: []string{"--format=csh"}, wantErr: `unknown format "csh"`},
+		{name: "extra args", args: []string{"static", "other"}, wantErr: "unexpected arguments"},
+		{name: "missing profile", args: []string{"nope"}, wantErr: "not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+			keyring.Set(keyringService, "static", `{"Version":1,"AccessKeyId":"AKIA","SecretAccessKey":"s"}`) //nolint:errcheck,gosec // ok
+			keyring.Set(keyringService, "role", `{"Version":1,"AccessKeyId":"ASIA",`+                         //nolint:errcheck,gosec // ok
+				`"SecretAccessKey":"it's \"$x\"\\n","SessionToken":"tok","RoleArn":"arn","SourceProfile":"static",`+
+				`"Expiration":"2099-01-15T10:30:00Z"}`)
+
+			ap := app{store: keyringStore{}, config: config{AWSProfile: "role", AWSRegion: "eu-west-1"}}
+
+			var buf bytes.Buffer
+
+			err := ap.env(t.Context(), &buf, tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("env() error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil || !strings.Contains(buf.String(), tt.want) {
+				t.Errorf("env() = %s, %v, want\n%s", buf.String(), err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+)
+
+// exitCodeError makes awbus exit with the exit code of the command it ran.
+type exitCodeError struct {
+	code int
+}
+
+// execCommand runs a command with the credentials of a profile in its
+// environment or, with --server, served by a container credentials endpoint
+// (so long running commands always get fresh ones). Signals are forwarded to
+// the command, except the terminal ones it gets anyway, and its exit code
+// becomes that of awbus.
+func (a *app) execCommand(ctx context.Context, args []string) (err error) {
+	var server bool
+
+	name := a.AWSProfile
+
+	flags := flag.NewFlagSet("exec", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&name, "profile", name, "profile")
+	flags.BoolVar(&server, "server", false, "serve credentials from a container credentials endpoint")
+
+	if err = flags.Parse(args); err != nil {
+		return fmt.Errorf("exec: %w", err)
+	}
+
+	if flags.NArg() == 0 {
+		return errors.New("exec requires a command: awbus exec [--profile p] [--server] -- cmd [args...]")
+	}
+
+	c, err := a.resolveAndMaybeRefresh(ctx, name)
+	if err != nil {
+		return
+	}
+
+	vars := c.envVars(a.AWSRegion)
+
+	if server {
+		uri, token, stop, serr := a.serveContainerCredentials(ctx, "127.0.0.1:0", name)
+		if serr != nil {
+			return serr
+		}
+		defer stop()
+
+		vars = []envVar{
+			{"AWS_CONTAINER_CREDENTIALS_FULL_URI", uri},
+			{"AWS_CONTAINER_AUTHORIZATION_TOKEN", token},
+			{"AWS_REGION", a.AWSRegion},
+			{"AWS_DEFAULT_REGION", a.AWSRegion},
+		}
+	}
+
+	env := childEnv(os.Environ())
+
+	for _, v := range vars {
+		if v.value != "" {
+			env = append(env, v.name+"="+v.value)
+		}
+	}
+
+	return runChild(ctx, flags.Args(), env)
+}
+
+// serveContainerCredentials serves the credentials of profile on addr, in
+// the background, with a random authorization token, until stopped.
+func (a *app) serveContainerCredentials(ctx context.Context, addr, profile string) (
+	uri, token string, stop func(), err error,
+) {
+	token = rand.Text()
+
+	bound, stop, err := startServer(ctx, addr, a.containerCredentialsHandler(profile, token))
+	if err != nil {
+		return
+	}
+
+	return "http://" + bound + "/", token, stop, nil
+}
+
+// childEnv is env without the variables that would make SDKs use other
+// credentials than the ones awbus provides.
+func childEnv(env []string) []string {
+	drop := []string{
+		"AWS_PROFILE", "AWS_DEFAULT_PROFILE",
+		"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_SESSION_TOKEN", "AWS_SECURITY_TOKEN", "AWS_CREDENTIAL_EXPIRATION",
+		"AWS_CONTAINER_CREDENTIALS_FULL_URI", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI",
+		"AWS_CONTAINER_AUTHORIZATION_TOKEN", "AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE",
+	}
+
+	return slices.DeleteFunc(slices.Clone(env), func(kv string) bool {
+		name, _, _ := strings.Cut(kv, "=")
+		return slices.Contains(drop, name)
+	})
+}
+
+// runChild runs argv with env, forwarding signals to it (and ignoring the
+// ones the terminal sends it, too) until it exits.
+func runChild(ctx context.Context, argv, env []string) (err error) {
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...) //nolint:gosec // User given.
+	cmd.Env = env
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	sigs, ignored := make(chan os.Signal, 1), make(chan os.Signal, 1)
+	signal.Notify(ignored, ignoredSignals()...)
+
+	if fwd := forwardedSignals(); len(fwd) > 0 { // None would mean all.
+		signal.Notify(sigs, fwd...)
+	}
+
+	defer signal.Stop(sigs)
+	defer signal.Stop(ignored)
+
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("exec %s: %w", argv[0], err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		for {
+			select {
+			case sig := <-sigs:
+				cmd.Process.Signal(sig) //nolint:errcheck,gosec // It may have exited already.
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var exitErr *exec.ExitError
+
+	if err = cmd.Wait(); errors.As(err, &exitErr) {
+		return exitCodeError{exitCode(exitErr.ProcessState)}
+	}
+
+	return
+}
+
+func (e exitCodeError) Error() string {
+	return fmt.Sprintf("exit status %d", e.code)
+}
@@ -0,0 +1,158 @@
+//nolint:lll // ok
+package main
+
+import (
+	"encoding/json/v2"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials/endpointcreds"
+	"github.com/zalando/go-keyring"
+)
+
+func TestAppExecCommand(t *testing.T) {
+	t.Setenv("AWS_PROFILE", "other")
+	t.Setenv("AWS_SESSION_TOKEN", "stale")
+
+	tests := []struct {
+		name     string
+		wantErr  string
+		args     []string
+		wantCode int
+	}{
+		{
+			name: "environment",
+			args: []string{"--", "sh", "-c", `test "$AWS_ACCESS_KEY_ID" = AKIA -a "$AWS_REGION" = eu-west-1 ` +
+				`-a -z "$AWS_PROFILE" -a -z "${AWS_SESSION_TOKEN+x}" && exit 3`},
+			wantCode: 3,
+		},
+		{
+			name: "server",
+			args: []string{"--server", "--", "sh", "-c", `test -n "$AWS_CONTAINER_CREDENTIALS_FULL_URI" ` +
+				`-a -n "$AWS_CONTAINER_AUTHORIZATION_TOKEN" -a -z "$AWS_ACCESS_KEY_ID"`},
+		},
+		{
+			name:     "forwards signals",
+			args:     []string{"--", "sh", "-c", `trap 'kill $!; exit 7' TERM; sleep 5 & kill -TERM $PPID; wait`},
+			wantCode: 7,
+		},
+		{
+			name: "does not forward terminal signals",
+			args: []string{"--", "sh", "-c", `trap 'exit 9' INT; kill -INT $PPID; sleep 1`},
+		},
+		{name: "killed", args: []string{"--", "sh", "-c", "kill -KILL $$"}, wantCode: 137},
+		{name: "no command", args: []string{"--"}, wantErr: "requires a command"},
+		{name: "missing profile", args: []string{"--profile", "nope", "--", "true"}, wantErr: "not found"},
+		{name: "not found", args: []string{"--", "/nonexistent"}, wantErr: "exec /nonexistent"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+			keyring.Set(keyringService, "static", `{"Version":1,"AccessKeyId":"AKIA","SecretAccessKey":"s"}`) //nolint:errcheck,gosec // ok
+
+			ap := app{store: keyringStore{}, config: config{AWSProfile: "static", AWSRegion: "eu-west-1"}}
+
+			err := ap.execCommand(t.Context(), tt.args)
+
+			var ee exitCodeError
+
+			switch {
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("execCommand() error = %v, want %q", err, tt.wantErr)
+				}
+			case tt.wantCode != 0:
+				if !errors.As(err, &ee) || ee.code != tt.wantCode {
+					t.Errorf("execCommand() error = %v, want exit status %d", err, tt.wantCode)
+				}
+			case err != nil:
+				t.Errorf("execCommand() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestContainerCredentialsHandler(t *testing.T) {
+	keyring.MockInit()
+	keyring.Set(keyringService, "static", `{"Version":1,"AccessKeyId":"AKIA","SecretAccessKey":"s"}`) //nolint:errcheck,gosec // ok
+
+	ap := app{store: keyringStore{}}
+
+	tests := []struct {
+		name       string
+		profile    string
+		token      string
+		wantStatus int
+	}{
+		{name: "ok", profile: "static", token: "tok", wantStatus: http.StatusOK},
+		{name: "bad token", profile: "static", token: "guess", wantStatus: http.StatusUnauthorized},
+		{name: "no token", profile: "static", wantStatus: http.StatusUnauthorized},
+		{name: "missing profile", profile: "nope", token: "tok", wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequestWithContext(t.Context(), http.MethodGet, "/", nil)
+			if tt.token != "" {
+				req.Header.Set("Authorization", tt.token)
+			}
+
+			rec := httptest.NewRecorder()
+			ap.containerCredentialsHandler(tt.profile, "tok").ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got containerCredentials
+
+			if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.AccessKeyID != "AKIA" || got.SecretAccessKey != "s" || got.Expiration.Before(time.Now()) {
+				t.Errorf("credentials = %+v", got)
+			}
+		})
+	}
+}
+
+func TestChildEnv(t *testing.T) {
+	got := childEnv([]string{"HOME=/root", "AWS_PROFILE=x", "AWS_REGION=r", "AWS_ACCESS_KEY_ID=k", "AWS_PROFILES=y"})
+	if want := []string{"HOME=/root", "AWS_REGION=r", "AWS_PROFILES=y"}; !slices.Equal(got, want) {
+		t.Errorf("childEnv() = %v, want %v", got, want)
+	}
+}
+
+func TestServeContainerCredentials(t *testing.T) {
+	keyring.MockInit()
+	keyring.Set(keyringService, "static", `{"Version":1,"AccessKeyId":"AKIA","SecretAccessKey":"s"}`) //nolint:errcheck,gosec // ok
+
+	ap := app{store: keyringStore{}}
+
+	uri, token, stop, err := ap.serveContainerCredentials(t.Context(), "127.0.0.1:0", "static")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	got, err := endpointcreds.New(uri, func(o *endpointcreds.Options) { o.AuthorizationToken = token }).Retrieve(t.Context())
+	if err != nil || got.AccessKeyID != "AKIA" || got.SecretAccessKey != "s" || !got.CanExpire {
+		t.Errorf("Retrieve() = %+v, %v", got, err)
+	}
+
+	_, err = endpointcreds.New(uri).Retrieve(t.Context())
+	if err == nil || !strings.Contains(err.Error(), "invalid authorization token") {
+		t.Errorf("Retrieve() without token error = %v", err)
+	}
+}
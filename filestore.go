@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// fileStore keeps all secrets in a single file, encrypted with AES-256-GCM
+// under a PBKDF2-SHA256 key derived from a passphrase. Writes are atomic
+// (rename) and serialized across processes by a lock file.
+type fileStore struct {
+	passphraseSource
+
+	path       string
+	salt, key  []byte
+	iterations int
+}
+
+// passphraseSource reads a passphrase from AWBUS_PASSPHRASE, the output of
+// AWBUS_PASSPHRASE_COMMAND or else the terminal, in this order. A new
+// passphrase typed on the terminal is asked for twice.
+type passphraseSource struct {
+	prompt     func(label string, val *string) error
+	label      string
+	passphrase string
+	command    string
+}
+
+// fileEnvelope is the on-disk format; Data is the encrypted fileSecrets JSON.
+type fileEnvelope struct {
+	Salt       []byte `json:"Salt"`
+	Nonce      []byte `json:"Nonce"`
+	Data       []byte `json:"Data"`
+	Version    int    `json:"Version"`
+	Iterations int    `json:"Iterations"`
+}
+
+// fileSecrets maps service to username to secret.
+type fileSecrets map[string]map[string]string
+
+const (
+	backendFile           = "file"
+	defaultFileIterations = 600_000
+	fileSaltSize          = 16
+	fileKeySize           = 32
+	lockTimeout           = 10 * time.Second
+	lockPollInterval      = 50 * time.Millisecond
+	privateDirMode        = 0o700
+	privateFileMode       = 0o600
+)
+
+func newFileStore(cfg *config, prompt func(label string, val *string) error) (s *fileStore, err error) {
+	s = &fileStore{
+		passphraseSource: newPassphraseSource(cfg, prompt),
+		path:             cfg.AwbusFile,
+		iterations:       defaultFileIterations,
+	}
+
+	if s.path == "" {
+		var dir string
+
+		if dir, err = os.UserConfigDir(); err != nil {
+			return nil, fmt.Errorf("file backend: %w", err)
+		}
+
+		s.path = filepath.Join(dir, keyringService, "secrets.enc")
+	}
+
+	s.label = "Passphrase for " + s.path
+
+	return
+}
+
+func (s *fileStore) Get(service, username string) (string, error) {
+	secrets, _, err := s.read()
+	if err != nil {
+		return "", err
+	}
+
+	secret, ok := secrets[service][username]
+	if !ok {
+		return "", fmt.Errorf("%s/%s: %w", service, username, errNotFound)
+	}
+
+	return secret, nil
+}
+
+func (s *fileStore) Set(service, username, secret string) error {
+	return s.update(func(secrets fileSecrets) error {
+		if secrets[service] == nil {
+			secrets[service] = map[string]string{}
+		}
+
+		secrets[service][username] = secret
+
+		return nil
+	})
+}
+
+func (s *fileStore) Delete(service, username string) error {
+	return s.update(func(secrets fileSecrets) error {
+		if _, ok := secrets[service][username]; !ok {
+			return fmt.Errorf("%s/%s: %w", service, username, errNotFound)
+		}
+
+		delete(secrets[service], username)
+
+		if len(secrets[service]) == 0 {
+			delete(secrets, service)
+		}
+
+		return nil
+	})
+}
+
+func (s *fileStore) List(service string) ([]string, error) {
+	secrets, _, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.Sorted(maps.Keys(secrets[service])), nil
+}
+
+// update applies fn to the secrets under the file lock.
+func (s *fileStore) update(fn func(fileSecrets) error) (err error) {
+	if err = os.MkdirAll(filepath.Dir(s.path), privateDirMode); err != nil {
+		return
+	}
+
+	unlock, err := lockFile(s.path+".lock", lockTimeout)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	secrets, env, err := s.read()
+	if err != nil {
+		return
+	}
+
+	if err = fn(secrets); err != nil {
+		return
+	}
+
+	return s.write(secrets, env)
+}
+
+func (s *fileStore) read() (secrets fileSecrets, env fileEnvelope, err error) {
+	raw, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fileSecrets{}, env, nil
+	} else if err != nil {
+		return
+	}
+
+	if err = json.Unmarshal(raw, &env); err != nil {
+		return nil, env, fmt.Errorf("parse %s: %w", s.path, err)
+	}
+
+	aead, err := s.aead(env.Salt, env.Iterations, false)
+	if err != nil {
+		return
+	}
+
+	plain, err := aead.Open(nil, env.Nonce, env.Data, nil)
+	if err != nil {
+		return nil, env, fmt.Errorf("decrypt %s: wrong passphrase or corrupted file", s.path)
+	}
+
+	err = json.Unmarshal(plain, &secrets)
+
+	return
+}
+
+func (s *fileStore) write(secrets fileSecrets, env fileEnvelope) (err error) {
+	create := env.Salt == nil
+	if create {
+		env = fileEnvelope{Salt: make([]byte, fileSaltSize), Iterations: s.iterations}
+		rand.Read(env.Salt) //nolint:errcheck,gosec // Never fails.
+	}
+
+	plain, err := json.Marshal(secrets)
+	if err != nil {
+		return
+	}
+
+	aead, err := s.aead(env.Salt, env.Iterations, create)
+	if err != nil {
+		return
+	}
+
+	env.Version = 1
+	env.Nonce = make([]byte, aead.NonceSize())
+	rand.Read(env.Nonce) //nolint:errcheck,gosec // Never fails.
+	env.Data = aead.Seal(nil, env.Nonce, plain, nil)
+
+	raw, err := json.Marshal(env)
+	if err != nil {
+		return
+	}
+
+	return writeFileAtomic(s.path, raw)
+}
+
+// aead is the cipher for salt, with the key derived from the passphrase (a
+// new one, when creating the file).
+func (s *fileStore) aead(salt []byte, iterations int, create bool) (aead cipher.AEAD, err error) {
+	if s.key == nil || !bytes.Equal(s.salt, salt) {
+		var pass string
+
+		if pass, err = s.getPassphrase(create); err != nil {
+			return
+		}
+
+		if s.key, err = pbkdf2.Key(sha256.New, pass, salt, iterations, fileKeySize); err != nil {
+			return
+		}
+
+		s.salt = salt
+	}
+
+	block, err := aes.NewCipher(s.key)
+	if err != nil {
+		return
+	}
+
+	return cipher.NewGCM(block)
+}
+
+func newPassphraseSource(cfg *config, prompt func(label string, val *string) error) passphraseSource {
+	return passphraseSource{prompt: prompt, passphrase: cfg.AwbusPassphrase, command: cfg.AwbusPassphraseCommand}
+}
+
+// getPassphrase gets the passphrase, which is a new one when create is set.
+func (s *passphraseSource) getPassphrase(create bool) (pass string, err error) {
+	switch {
+	case s.passphrase != "":
+		pass = s.passphrase
+	case s.command != "":
+		args := strings.Fields(s.command)
+		if len(args) == 0 {
+			return "", errors.New("passphrase command: empty")
+		}
+
+		var out []byte
+
+		out, err = exec.CommandContext(context.Background(), args[0], args[1:]...).Output() //nolint:gosec // User configured.
+		if err != nil {
+			return "", fmt.Errorf("passphrase command: %w", err)
+		}
+
+		pass = strings.TrimSpace(string(out))
+	default:
+		if err = s.prompt(s.label, &pass); err != nil {
+			return
+		}
+
+		var again string
+
+		if create && pass != "" {
+			if err = s.prompt(s.label+" (again)", &again); err != nil {
+				return
+			}
+
+			if again != pass {
+				return "", errors.New("passphrases do not match")
+			}
+		}
+	}
+
+	if pass == "" {
+		return "", errors.New("empty passphrase")
+	}
+
+	return
+}
+
+// writeFileAtomic replaces path with data via a temporary file and rename.
+func writeFileAtomic(path string, data []byte) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			os.Remove(f.Name()) //nolint:errcheck,gosec // ok
+		}
+	}()
+
+	if _, err = f.Write(data); err != nil {
+		f.Close() //nolint:errcheck,gosec // ok
+		return
+	}
+
+	if err = f.Sync(); err != nil {
+		f.Close() //nolint:errcheck,gosec // ok
+		return
+	}
+
+	if err = f.Close(); err != nil {
+		return
+	}
+
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func newTestFileStore(t *testing.T, cfg *config) *fileStore {
+	t.Helper()
+
+	if cfg.AwbusFile == "" {
+		cfg.AwbusFile = filepath.Join(t.TempDir(), "awbus", "secrets.enc")
+	}
+
+	st, err := newFileStore(cfg, func(string, *string) error { return errors.New("no terminal") })
+	if err != nil {
+		t.Fatalf("newFileStore() error = %v", err)
+	}
+
+	st.iterations = 1000
+
+	return st
+}
+
+func TestFileStore(t *testing.T) {
+	st := newTestFileStore(t, &config{AwbusPassphrase: "hunter2"})
+
+	if _, err := st.Get(keyringService, "p"); !errors.Is(err, errNotFound) {
+		t.Errorf("Get() on missing file error = %v, want %v", err, errNotFound)
+	}
+
+	for _, name := range []string{"b", "a"} {
+		if err := st.Set(keyringService, name, "value-"+name); err != nil {
+			t.Fatalf("Set(%s) error = %v", name, err)
+		}
+	}
+
+	if got, err := st.Get(keyringService, "a"); err != nil || got != "value-a" {
+		t.Errorf("Get() = %s, %v", got, err)
+	}
+
+	if got, err := st.List(keyringService); err != nil || !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("List() = %v, %v", got, err)
+	}
+
+	if err := st.Delete(keyringService, "a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if err := st.Delete(keyringService, "a"); !errors.Is(err, errNotFound) {
+		t.Errorf("Delete() twice error = %v, want %v", err, errNotFound)
+	}
+
+	raw, err := os.ReadFile(st.path)
+	if err != nil || strings.Contains(string(raw), "value-b") {
+		t.Errorf("file is not encrypted: %s, %v", raw, err)
+	}
+
+	if runtime.GOOS != "windows" {
+		if fi, serr := os.Stat(st.path); serr != nil || fi.Mode().Perm() != 0o600 {
+			t.Errorf("file mode = %v, %v", fi.Mode().Perm(), serr)
+		}
+	}
+
+	// A fresh store (new process) derives the key again from the file's salt.
+	other := newTestFileStore(t, &config{AwbusFile: st.path, AwbusPassphraseCommand: "go env GOOS"})
+	if _, err = other.Get(keyringService, "b"); err == nil {
+		t.Error("Get() with wrong passphrase should fail")
+	}
+
+	other = newTestFileStore(t, &config{AwbusFile: st.path, AwbusPassphrase: "hunter2"})
+	if got, gerr := other.Get(keyringService, "b"); gerr != nil || got != "value-b" {
+		t.Errorf("Get() from fresh store = %s, %v", got, gerr)
+	}
+}
+
+func TestFileStoreNewPassphrase(t *testing.T) {
+	st := newTestFileStore(t, &config{})
+
+	var labels []string
+
+	st.prompt = func(label string, val *string) error {
+		labels = append(labels, label)
+		*val = "typed"
+
+		return nil
+	}
+
+	if err := st.Set("svc", "user", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(labels) != 2 || !strings.HasSuffix(labels[1], "(again)") {
+		t.Errorf("creating prompted %q, want the passphrase twice", labels)
+	}
+
+	other := newTestFileStore(t, &config{AwbusFile: st.path})
+	other.prompt, labels = st.prompt, nil
+
+	if got, err := other.Get("svc", "user"); err != nil || got != "secret" || len(labels) != 1 {
+		t.Errorf("Get() = %q, %v, prompted %q, want the passphrase once", got, err, labels)
+	}
+}
+
+func TestFileStorePassphrase(t *testing.T) { //nolint:funlen // ok
+	tests := []struct {
+		prompt  func(string, *string) error
+		name    string
+		want    string
+		cfg     config
+		create  bool
+		wantErr bool
+	}{
+		{name: "env", cfg: config{AwbusPassphrase: "env-pass", AwbusPassphraseCommand: "false"}, want: "env-pass"},
+		{name: "command", cfg: config{AwbusPassphraseCommand: "go env GOOS"}, want: runtime.GOOS},
+		{name: "failing command", cfg: config{AwbusPassphraseCommand: "go no-such-command"}, wantErr: true},
+		{name: "blank command", cfg: config{AwbusPassphraseCommand: " \t "}, wantErr: true},
+		{
+			name: "prompt",
+			prompt: func(label string, val *string) error {
+				*val = "typed"
+				return nil
+			},
+			want: "typed",
+		},
+		{
+			name: "new, confirmed",
+			prompt: func(label string, val *string) error {
+				*val = "typed"
+				return nil
+			},
+			create: true,
+			want:   "typed",
+		},
+		{
+			name: "new, mistyped",
+			prompt: func(label string, val *string) error {
+				*val = label
+				return nil
+			},
+			create:  true,
+			wantErr: true,
+		},
+		{
+			name: "empty prompt",
+			prompt: func(label string, val *string) error {
+				return nil
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			st := newTestFileStore(t, &tt.cfg)
+			if tt.prompt != nil {
+				st.prompt = tt.prompt
+			}
+
+			got, err := st.getPassphrase(tt.create)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("getPassphrase() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("getPassphrase() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileStoreConcurrentSet(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.enc")
+
+	var wg sync.WaitGroup
+
+	for i := range 8 {
+		wg.Go(func() {
+			// Separate stores, as separate awbus processes would be.
+			st := newTestFileStore(t, &config{AwbusFile: path, AwbusPassphrase: "hunter2"})
+			if err := st.Set(keyringService, strconv.Itoa(i), "v"); err != nil {
+				t.Errorf("Set() error = %v", err)
+			}
+		})
+	}
+
+	wg.Wait()
+
+	st := newTestFileStore(t, &config{AwbusFile: path, AwbusPassphrase: "hunter2"})
+	if got, err := st.List(keyringService); err != nil || len(got) != 8 {
+		t.Errorf("List() = %v, %v", got, err)
+	}
+}
+
+func TestAppResolveFileStore(t *testing.T) {
+	st := newTestFileStore(t, &config{AwbusPassphrase: "hunter2"})
+	c := Creds{AccessKeyID: "AKIA123", SecretAccessKey: "secret123"}
+
+	if err := c.store(st, "p"); err != nil {
+		t.Fatalf("store() error = %v", err)
+	}
+
+	a := app{store: st}
+
+	got, err := a.resolveAndMaybeRefresh(t.Context(), "p")
+	if err != nil || got.AccessKeyID != "AKIA123" {
+		t.Errorf("resolveAndMaybeRefresh() = %+v, %v", got, err)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net"
+	"strconv"
+	"syscall"
+	"testing"
+)
+
+func TestLimitHopsWildcard(t *testing.T) {
+	for _, addr := range []string{":0", "0.0.0.0:0", "127.0.0.1:0"} {
+		t.Run(addr, func(t *testing.T) {
+			ln, err := (&net.ListenConfig{Control: limitHops}).Listen(t.Context(), "tcp", addr)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer ln.Close() //nolint:errcheck // ok
+
+			port := ln.Addr().(*net.TCPAddr).Port //nolint:errcheck,forcetypeassert // ok
+
+			client, err := (&net.Dialer{}).DialContext(t.Context(), "tcp4", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close() //nolint:errcheck // ok
+
+			conn, err := ln.Accept()
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close() //nolint:errcheck // ok
+
+			if ttl := ipTTL(t, conn); ttl != 1 {
+				t.Errorf("IPv4 TTL = %d, want 1 (listening on %s)", ttl, ln.Addr())
+			}
+		})
+	}
+}
+
+// ipTTL is the IPv4 TTL of the replies sent on conn.
+func ipTTL(t *testing.T, conn net.Conn) (ttl int) {
+	t.Helper()
+
+	raw, err := conn.(*net.TCPConn).SyscallConn() //nolint:errcheck,forcetypeassert // ok
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cerr := raw.Control(func(fd uintptr) {
+		ttl, err = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TTL)
+	})
+	if cerr != nil || err != nil {
+		t.Fatal(cerr, err)
+	}
+
+	return
+}
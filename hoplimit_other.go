@@ -0,0 +1,10 @@
+//go:build !unix
+
+package main
+
+import "syscall"
+
+// limitHops is a no-op: servers only rely on their authorization tokens.
+func limitHops(_, _ string, _ syscall.RawConn) error {
+	return nil
+}
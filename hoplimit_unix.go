@@ -0,0 +1,27 @@
+//go:build unix
+
+package main
+
+import (
+	"cmp"
+	"strings"
+	"syscall"
+)
+
+// limitHops sets the IP TTL (hop limit, for IPv6) of the socket to 1, as the
+// EC2 instance metadata service does, so responses cannot be routed further
+// than the directly attached networks. IPv6 sockets get both: wildcard
+// addresses are dual-stack and also serve IPv4 clients.
+func limitHops(network, _ string, conn syscall.RawConn) (err error) {
+	cerr := conn.Control(func(fd uintptr) {
+		if strings.HasSuffix(network, "6") {
+			err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_UNICAST_HOPS, 1)
+			// Fails on IPv6-only sockets, which need none.
+			syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TTL, 1) //nolint:errcheck,gosec // ok
+		} else {
+			err = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TTL, 1)
+		}
+	})
+
+	return cmp.Or(cerr, err)
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// imdsCredentials is the EC2 instance metadata service role credentials
+// response.
+type imdsCredentials struct { //nolint:govet // ok
+	Code            string    `json:"Code"`
+	LastUpdated     time.Time `json:"LastUpdated"`
+	Type            string    `json:"Type"`
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+// imdsTokens are the issued IMDSv2 session tokens, with their expiration.
+type imdsTokens struct {
+	tokens map[string]time.Time
+	mu     sync.Mutex
+}
+
+//nolint:gosec // Paths and header names, not credentials.
+const (
+	imdsTokenPath      = "/latest/api/token"
+	imdsCredsPath      = "/latest/meta-data/iam/security-credentials/"
+	imdsRegionPath     = "/latest/meta-data/placement/region"
+	imdsIdentityPath   = "/latest/dynamic/instance-identity/document"
+	imdsTokenHeader    = "X-Aws-Ec2-Metadata-Token"
+	imdsTokenTTLHeader = "X-Aws-Ec2-Metadata-Token-Ttl-Seconds"
+	imdsMaxTokenTTL    = 6 * time.Hour
+)
+
+// serveIMDS serves the credentials of a profile, as the role of the same
+// name, from an IMDSv2 compatible metadata service until interrupted,
+// printing the environment that points SDKs to it.
+func (a *app) serveIMDS(ctx context.Context, w io.Writer, args []string) (err error) {
+	name, addr := a.AWSProfile, defaultServeAddr
+
+	flags := flag.NewFlagSet("serve-imds", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&name, "profile", name, "profile")
+	flags.StringVar(&addr, "addr", addr, "listen address")
+
+	if err = flags.Parse(args); err != nil {
+		return fmt.Errorf("serve-imds: %w", err)
+	}
+
+	if _, err = a.resolveAndMaybeRefresh(ctx, name); err != nil {
+		return
+	}
+
+	bound, stop, err := startServer(ctx, addr, a.imdsHandler(name))
+	if err != nil {
+		return
+	}
+	defer stop()
+
+	v := envVar{"AWS_EC2_METADATA_SERVICE_ENDPOINT", "http://" + bound + "/"}
+	if _, err = fmt.Fprintln(w, envLine("dotenv", v)); err != nil {
+		return
+	}
+
+	waitForInterrupt(ctx)
+
+	return
+}
+
+// imdsHandler emulates the IMDSv2 session token handshake and the role
+// credentials (and region) endpoints. As with IMDSv2, requests without a
+// valid session token, and token requests carrying X-Forwarded-For (i.e.
+// coming through a proxy), are refused.
+func (a *app) imdsHandler(profile string) http.Handler {
+	resolve := a.serialResolver(profile)
+	tokens := &imdsTokens{tokens: map[string]time.Time{}}
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("PUT "+imdsTokenPath, func(w http.ResponseWriter, r *http.Request) {
+		ttl, err := strconv.Atoi(r.Header.Get(imdsTokenTTLHeader))
+		if err != nil || ttl < 1 || time.Duration(ttl)*time.Second > imdsMaxTokenTTL {
+			http.Error(w, "invalid "+imdsTokenTTLHeader, http.StatusBadRequest)
+			return
+		}
+
+		if r.Header.Get("X-Forwarded-For") != "" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		w.Header().Set(imdsTokenTTLHeader, strconv.Itoa(ttl))
+		io.WriteString(w, tokens.issue(time.Duration(ttl)*time.Second)) //nolint:errcheck,gosec // The client is gone.
+	})
+
+	mux.HandleFunc("GET "+imdsCredsPath+"{$}", func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, profile) //nolint:errcheck,gosec // The client is gone.
+	})
+
+	mux.HandleFunc("GET "+imdsCredsPath+"{role}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("role") != profile {
+			http.NotFound(w, r)
+			return
+		}
+
+		c, err := resolve(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		replyJSON(w, http.StatusOK, imdsCredentials{
+			Code: "Success", LastUpdated: time.Now().UTC(), Type: "AWS-HMAC",
+			AccessKeyID: c.AccessKeyID, SecretAccessKey: c.SecretAccessKey, Token: c.SessionToken,
+			Expiration: c.servedExpiration(),
+		})
+	})
+
+	mux.HandleFunc("GET "+imdsRegionPath, func(w http.ResponseWriter, _ *http.Request) {
+		io.WriteString(w, a.AWSRegion) //nolint:errcheck,gosec // The client is gone.
+	})
+
+	// The Go SDK gets the region from the (otherwise unused) identity document.
+	mux.HandleFunc("GET "+imdsIdentityPath, func(w http.ResponseWriter, _ *http.Request) {
+		replyJSON(w, http.StatusOK, map[string]string{"region": a.AWSRegion})
+	})
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != imdsTokenPath && !tokens.valid(r.Header.Get(imdsTokenHeader)) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// issue returns a new token, valid for ttl, forgetting the expired ones.
+func (t *imdsTokens) issue(ttl time.Duration) string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := time.Now()
+	maps.DeleteFunc(t.tokens, func(_ string, exp time.Time) bool { return now.After(exp) })
+
+	token := rand.Text()
+	t.tokens[token] = now.Add(ttl)
+
+	return token
+}
+
+func (t *imdsTokens) valid(token string) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	exp, ok := t.tokens[strings.TrimSpace(token)]
+
+	return ok && time.Now().Before(exp)
+}
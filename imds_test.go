@@ -0,0 +1,124 @@
+//nolint:lll // ok
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/credentials/ec2rolecreds"
+	"github.com/aws/aws-sdk-go-v2/feature/ec2/imds"
+	"github.com/zalando/go-keyring"
+)
+
+func TestAppServeIMDS(t *testing.T) {
+	keyring.MockInit()
+	keyring.Set(keyringService, "static", `{"Version":1,"AccessKeyId":"AKIA","SecretAccessKey":"s"}`) //nolint:errcheck,gosec // ok
+
+	ap := app{store: keyringStore{}, config: config{AWSProfile: "static", AWSRegion: "eu-west-1"}}
+
+	if err := ap.serveIMDS(t.Context(), io.Discard, []string{"--profile", "nope"}); err == nil {
+		t.Error("serveIMDS() missing profile error = nil")
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+
+	go func() {
+		errc <- ap.serveIMDS(ctx, pw, nil)
+
+		pw.Close() //nolint:errcheck,gosec // ok
+	}()
+
+	scanner := bufio.NewScanner(pr)
+	scanner.Scan()
+
+	_, endpoint, _ := strings.Cut(scanner.Text(), "=")
+	client := imds.New(imds.Options{Endpoint: endpoint})
+
+	got, err := ec2rolecreds.New(func(o *ec2rolecreds.Options) { o.Client = client }).Retrieve(ctx)
+	if err != nil || got.AccessKeyID != "AKIA" || got.SecretAccessKey != "s" || !got.CanExpire {
+		t.Errorf("Retrieve() = %+v, %v", got, err)
+	}
+
+	if region, rerr := client.GetRegion(ctx, nil); rerr != nil || region.Region != "eu-west-1" {
+		t.Errorf("GetRegion() = %+v, %v", region, rerr)
+	}
+
+	cancel()
+
+	if err = <-errc; err != nil {
+		t.Errorf("serveIMDS() error = %v", err)
+	}
+}
+
+func TestIMDSHandler(t *testing.T) {
+	keyring.MockInit()
+	keyring.Set(keyringService, "static", `{"Version":1,"AccessKeyId":"AKIA","SecretAccessKey":"s"}`) //nolint:errcheck,gosec // ok
+
+	ap := app{store: keyringStore{}}
+	h := ap.imdsHandler("static")
+
+	do := func(method, path string, headers ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequestWithContext(t.Context(), method, path, nil)
+		for i := 0; i < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		return rec
+	}
+
+	token := do(http.MethodPut, imdsTokenPath, imdsTokenTTLHeader, "60").Body.String()
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		headers    []string
+		wantStatus int
+	}{
+		{name: "no token", method: http.MethodGet, path: imdsCredsPath + "static", wantStatus: http.StatusUnauthorized},
+		{name: "bad token", method: http.MethodGet, path: imdsCredsPath + "static", headers: []string{imdsTokenHeader, "guess"}, wantStatus: http.StatusUnauthorized},
+		{name: "role", method: http.MethodGet, path: imdsCredsPath, headers: []string{imdsTokenHeader, token}, wantStatus: http.StatusOK},
+		{name: "credentials", method: http.MethodGet, path: imdsCredsPath + "static", headers: []string{imdsTokenHeader, token}, wantStatus: http.StatusOK},
+		{name: "other role", method: http.MethodGet, path: imdsCredsPath + "other", headers: []string{imdsTokenHeader, token}, wantStatus: http.StatusNotFound},
+		{name: "unknown path", method: http.MethodGet, path: "/latest/user-data", headers: []string{imdsTokenHeader, token}, wantStatus: http.StatusNotFound},
+		{name: "token without ttl", method: http.MethodPut, path: imdsTokenPath, wantStatus: http.StatusBadRequest},
+		{name: "token ttl too long", method: http.MethodPut, path: imdsTokenPath, headers: []string{imdsTokenTTLHeader, "21601"}, wantStatus: http.StatusBadRequest},
+		{name: "proxied token", method: http.MethodPut, path: imdsTokenPath, headers: []string{imdsTokenTTLHeader, "60", "X-Forwarded-For", "10.0.0.1"}, wantStatus: http.StatusForbidden},
+		{name: "token via get", method: http.MethodGet, path: imdsTokenPath, headers: []string{imdsTokenTTLHeader, "60"}, wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if rec := do(tt.method, tt.path, tt.headers...); rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestIMDSTokens(t *testing.T) {
+	tokens := &imdsTokens{tokens: map[string]time.Time{}}
+
+	stale := tokens.issue(-time.Second)
+	fresh := tokens.issue(time.Minute)
+
+	if tokens.valid(stale) || !tokens.valid(fresh) || tokens.valid("") {
+		t.Errorf("valid() = %v, %v", tokens.valid(stale), tokens.valid(fresh))
+	}
+
+	tokens.issue(time.Minute)
+
+	if _, ok := tokens.tokens[stale]; ok {
+		t.Error("issue() kept an expired token")
+	}
+}
@@ -0,0 +1,904 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20"
+)
+
+// kdbxDB is a decrypted KDBX 4 (KeePass, KeePassXC) database. The outer header
+// settings are kept, so it is written back with its own cipher, KDF and
+// compression, and the XML is kept as a generic tree, so that groups, entries
+// and fields awbus knows nothing about survive a round trip.
+type kdbxDB struct {
+	root         *xmlNode
+	key          *kdbxKey
+	cipherID     string
+	kdf          kdbxVariant
+	publicCustom []byte
+	binaries     [][]byte
+	version      uint32
+	compression  uint32
+}
+
+// kdbxKey is the composite key (master password and key file), with the
+// result of the last, slow, key derivation cached.
+type kdbxKey struct {
+	composite   []byte
+	kdfParams   []byte
+	transformed []byte
+}
+
+// kdbxVariant is a KDBX VariantDictionary (KDF parameters), kept in order.
+type kdbxVariant []kdbxVariantItem
+
+type kdbxVariantItem struct {
+	name  string
+	value []byte
+	typ   byte
+}
+
+// xmlNode is a generic XML element; Protected values hold the plain text.
+type xmlNode struct {
+	XMLName xml.Name
+	Content string     `xml:",chardata"`
+	Attrs   []xml.Attr `xml:",any,attr"`
+	Nodes   []*xmlNode `xml:",any"`
+}
+
+const (
+	kdbxSig1      = 0x9AA2D903
+	kdbxSig2      = 0xB54BFB67
+	kdbxVersion4  = 0x00040000
+	kdbxMajorMask = 0xFFFF0000
+
+	kdbxFieldEnd          = 0
+	kdbxFieldCipherID     = 2
+	kdbxFieldCompression  = 3
+	kdbxFieldMasterSeed   = 4
+	kdbxFieldIV           = 7
+	kdbxFieldKDF          = 11
+	kdbxFieldPublicCustom = 12
+
+	kdbxInnerStreamID  = 1
+	kdbxInnerStreamKey = 2
+	kdbxInnerBinary    = 3
+	kdbxStreamSalsa20  = 2
+	kdbxStreamChaCha20 = 3
+
+	kdbxCipherAES      = "\x31\xc1\xf2\xe6\xbf\x71\x43\x50\xbe\x58\x05\x21\x6a\xfc\x5a\xff"
+	kdbxCipherChaCha20 = "\xd6\x03\x8a\x2b\x8b\x6f\x4c\xb5\xa5\x24\x33\x9a\x31\xdb\xb5\x9a"
+	kdbxKDFAES         = "\xc9\xd9\xf3\x9a\x62\x8a\x44\x60\xbf\x74\x0d\x08\xc1\x8d\x4f\xea"
+	kdbxKDFArgon2d     = "\xef\x63\x6d\xdf\x8c\x29\x44\x4b\x91\xf7\xa9\xa4\x03\xe3\x0a\x0c"
+	kdbxKDFArgon2id    = "\x9e\x29\x8b\x19\x56\xdb\x47\x73\xb2\x3d\xfc\x3e\xc6\xf0\xa1\xe6"
+
+	kdbxVariantVersion = 0x0100
+	kdbxTypeUInt32     = 0x04
+	kdbxTypeUInt64     = 0x05
+	kdbxTypeBytes      = 0x42
+
+	kdbxNoCompression   = 0
+	kdbxGzipCompression = 1
+	kdbxSeedSize        = 32
+	kdbxStreamKeySize   = 64
+	kdbxBlockSize       = 1 << 20
+	kdbxMaxArgon2Memory = 1 << 20 // KiB (1 GiB), well above the KeePass and KeePassXC defaults.
+	kdbxHeaderIndex     = math.MaxUint64
+
+	// The origin of KDBX 4 times, 0001-01-01, in Unix seconds.
+	kdbxEpoch = 62135596800
+)
+
+var errKDBXKey = errors.New("wrong master password or key file")
+
+// newKDBXKey builds the composite key SHA256(SHA256(password) || key file key).
+func newKDBXKey(password string, keyFile []byte) (*kdbxKey, error) {
+	pw := sha256.Sum256([]byte(password))
+	h := sha256.New()
+	h.Write(pw[:])
+
+	if keyFile != nil {
+		kf, err := kdbxKeyFileKey(keyFile)
+		if err != nil {
+			return nil, err
+		}
+
+		h.Write(kf)
+	}
+
+	return &kdbxKey{composite: h.Sum(nil)}, nil
+}
+
+// kdbxKeyFileKey reads a key file: KeePass XML (version 1 or 2), 32 raw bytes,
+// 64 hex digits, or else any file, hashed.
+func kdbxKeyFileKey(raw []byte) ([]byte, error) {
+	var kf struct {
+		XMLName xml.Name `xml:"KeyFile"`
+		Version string   `xml:"Meta>Version"`
+		Data    struct {
+			Hash  string `xml:"Hash,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"Key>Data"`
+	}
+
+	if xml.Unmarshal(raw, &kf) == nil {
+		data := strings.Join(strings.Fields(kf.Data.Value), "")
+
+		if !strings.HasPrefix(kf.Version, "2.") {
+			return base64.StdEncoding.DecodeString(data)
+		}
+
+		key, err := hex.DecodeString(data)
+		if err != nil {
+			return nil, fmt.Errorf("key file: %w", err)
+		}
+
+		sum := sha256.Sum256(key)
+		hash := strings.Join(strings.Fields(kf.Data.Hash), "")
+
+		if hash != "" && !strings.EqualFold(hash, hex.EncodeToString(sum[:4])) {
+			return nil, errors.New("key file: hash mismatch")
+		}
+
+		return key, nil
+	}
+
+	switch len(raw) {
+	case sha256.Size:
+		return raw, nil
+	case 2 * sha256.Size:
+		if key, err := hex.DecodeString(string(raw)); err == nil {
+			return key, nil
+		}
+	}
+
+	sum := sha256.Sum256(raw)
+
+	return sum[:], nil
+}
+
+// newKDBX returns an empty database with a single root group.
+func newKDBX(kdf kdbxVariant) *kdbxDB {
+	now := kdbxTime()
+	root := newXMLNode("Group", "", newXMLNode("UUID", kdbxUUID()), newXMLNode("Name", "Root"),
+		kdbxTimes(now), newXMLNode("IsExpanded", "True"))
+
+	return &kdbxDB{
+		root: newXMLNode("KeePassFile", "",
+			newXMLNode("Meta", "", newXMLNode("Generator", keyringService), newXMLNode("DatabaseName", keyringService)),
+			newXMLNode("Root", "", root, newXMLNode("DeletedObjects", ""))),
+		cipherID:    kdbxCipherAES,
+		kdf:         kdf,
+		version:     kdbxVersion4,
+		compression: kdbxGzipCompression,
+	}
+}
+
+// kdbxArgon2Params are the KDF parameters for Argon2id; memory is in bytes.
+func kdbxArgon2Params(iterations, memory uint64, parallelism uint32) kdbxVariant {
+	salt := make([]byte, kdbxSeedSize)
+	rand.Read(salt) //nolint:errcheck,gosec // Never fails.
+
+	var kdf kdbxVariant
+
+	kdf.set("$UUID", kdbxTypeBytes, []byte(kdbxKDFArgon2id))
+	kdf.set("S", kdbxTypeBytes, salt)
+	kdf.set("P", kdbxTypeUInt32, binary.LittleEndian.AppendUint32(nil, parallelism))
+	kdf.set("M", kdbxTypeUInt64, binary.LittleEndian.AppendUint64(nil, memory))
+	kdf.set("I", kdbxTypeUInt64, binary.LittleEndian.AppendUint64(nil, iterations))
+	kdf.set("V", kdbxTypeUInt32, binary.LittleEndian.AppendUint32(nil, argon2Version))
+
+	return kdf
+}
+
+func readKDBX(raw []byte, key *kdbxKey) (db *kdbxDB, err error) {
+	src := bytes.NewReader(raw)
+
+	var sig [3]uint32
+
+	if err = binary.Read(src, binary.LittleEndian, &sig); err != nil || sig[0] != kdbxSig1 || sig[1] != kdbxSig2 {
+		return nil, errors.New("not a KeePass database")
+	}
+
+	if sig[2]&kdbxMajorMask != kdbxVersion4 {
+		return nil, fmt.Errorf("unsupported KDBX version %d.%d, only 4.x is", sig[2]>>16, sig[2]&0xFFFF) //nolint:mnd // ok
+	}
+
+	db = &kdbxDB{key: key, version: sig[2]}
+
+	seed, iv, err := db.readHeader(src)
+	if err != nil {
+		return nil, err
+	}
+
+	header := raw[:len(raw)-src.Len()]
+
+	var sums [2 * sha256.Size]byte
+
+	if _, err = io.ReadFull(src, sums[:]); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+
+	if sum := sha256.Sum256(header); !hmac.Equal(sum[:], sums[:sha256.Size]) {
+		return nil, errors.New("header checksum mismatch, the database is corrupted")
+	}
+
+	transformed, err := key.transform(db.kdf)
+	if err != nil {
+		return nil, err
+	}
+
+	encKey, hmacKey := kdbxKeys(seed, transformed)
+	if !hmac.Equal(kdbxHMAC(hmacKey, kdbxHeaderIndex, header), sums[sha256.Size:]) {
+		return nil, errKDBXKey
+	}
+
+	payload, err := kdbxReadBlocks(src, hmacKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if payload, err = db.crypt(encKey, iv, payload, false); err != nil {
+		return nil, err
+	}
+
+	if err = db.readInner(payload); err != nil {
+		db = nil
+	}
+
+	return db, err
+}
+
+// encode encrypts the database with a fresh master seed, IV and inner stream
+// key, keeping the KDF parameters (and so the cached key).
+func (db *kdbxDB) encode() (_ []byte, err error) {
+	seed := make([]byte, kdbxSeedSize)
+	rand.Read(seed) //nolint:errcheck,gosec // Never fails.
+
+	iv := make([]byte, aes.BlockSize)
+	if db.cipherID == kdbxCipherChaCha20 {
+		iv = iv[:chacha20.NonceSize]
+	}
+
+	rand.Read(iv) //nolint:errcheck,gosec // Never fails.
+
+	transformed, err := db.key.transform(db.kdf)
+	if err != nil {
+		return
+	}
+
+	inner, err := db.inner()
+	if err != nil {
+		return
+	}
+
+	encKey, hmacKey := kdbxKeys(seed, transformed)
+
+	payload, err := db.crypt(encKey, iv, inner, true)
+	if err != nil {
+		return
+	}
+
+	var out bytes.Buffer
+
+	db.writeHeader(&out, seed, iv)
+
+	header := bytes.Clone(out.Bytes())
+	sum := sha256.Sum256(header)
+	out.Write(sum[:])
+	out.Write(kdbxHMAC(hmacKey, kdbxHeaderIndex, header))
+
+	for idx := uint64(0); ; idx++ {
+		block := payload[:min(len(payload), kdbxBlockSize)]
+		payload = payload[len(block):]
+		size := binary.LittleEndian.AppendUint32(nil, uint32(len(block))) //nolint:gosec // At most kdbxBlockSize.
+
+		out.Write(kdbxHMAC(hmacKey, idx, binary.LittleEndian.AppendUint64(nil, idx), size, block))
+		out.Write(size)
+		out.Write(block)
+
+		if len(block) == 0 {
+			return out.Bytes(), nil
+		}
+	}
+}
+
+func (db *kdbxDB) readHeader(r *bytes.Reader) (seed, iv []byte, err error) {
+	for {
+		id, data, ferr := kdbxReadField(r)
+		if ferr != nil {
+			return nil, nil, fmt.Errorf("header: %w", ferr)
+		}
+
+		switch id {
+		case kdbxFieldEnd:
+			if len(seed) != kdbxSeedSize || iv == nil || db.cipherID == "" || db.kdf == nil {
+				return nil, nil, errors.New("header: missing fields")
+			}
+
+			return seed, iv, nil
+		case kdbxFieldCipherID:
+			db.cipherID = string(data)
+		case kdbxFieldCompression:
+			if len(data) != 4 { //nolint:mnd // uint32
+				return nil, nil, errors.New("header: bad compression flag")
+			}
+
+			db.compression = binary.LittleEndian.Uint32(data)
+		case kdbxFieldMasterSeed:
+			seed = data
+		case kdbxFieldIV:
+			iv = data
+		case kdbxFieldKDF:
+			if db.kdf, err = readKDBXVariant(data); err != nil {
+				return
+			}
+		case kdbxFieldPublicCustom:
+			db.publicCustom = data
+		}
+	}
+}
+
+func (db *kdbxDB) writeHeader(w *bytes.Buffer, seed, iv []byte) {
+	binary.Write(w, binary.LittleEndian, [3]uint32{kdbxSig1, kdbxSig2, db.version}) //nolint:errcheck,gosec // Never fails.
+
+	kdbxWriteField(w, kdbxFieldCipherID, []byte(db.cipherID))
+	kdbxWriteField(w, kdbxFieldCompression, binary.LittleEndian.AppendUint32(nil, db.compression))
+	kdbxWriteField(w, kdbxFieldMasterSeed, seed)
+	kdbxWriteField(w, kdbxFieldIV, iv)
+	kdbxWriteField(w, kdbxFieldKDF, db.kdf.bytes())
+
+	if db.publicCustom != nil {
+		kdbxWriteField(w, kdbxFieldPublicCustom, db.publicCustom)
+	}
+
+	kdbxWriteField(w, kdbxFieldEnd, []byte("\r\n\r\n"))
+}
+
+// readInner reads the inner header and the XML, decrypting protected values.
+func (db *kdbxDB) readInner(payload []byte) (err error) {
+	if db.compression == kdbxGzipCompression {
+		if payload, err = gunzip(payload); err != nil {
+			return
+		}
+	} else if db.compression != kdbxNoCompression {
+		return fmt.Errorf("unsupported compression %d", db.compression)
+	}
+
+	src := bytes.NewReader(payload)
+
+	var streamID uint32
+
+	var streamKey []byte
+
+	for id := byte(1); id != kdbxFieldEnd; {
+		var data []byte
+
+		if id, data, err = kdbxReadField(src); err != nil {
+			return fmt.Errorf("inner header: %w", err)
+		}
+
+		switch id {
+		case kdbxInnerStreamID:
+			if len(data) == 4 { //nolint:mnd // uint32
+				streamID = binary.LittleEndian.Uint32(data)
+			}
+		case kdbxInnerStreamKey:
+			streamKey = data
+		case kdbxInnerBinary:
+			db.binaries = append(db.binaries, data)
+		}
+	}
+
+	switch streamID {
+	case kdbxStreamChaCha20:
+	case kdbxStreamSalsa20:
+		return errors.New("unsupported inner stream Salsa20, only ChaCha20 (as KeePass 2.35+ and KeePassXC write KDBX 4) is")
+	default:
+		return fmt.Errorf("unsupported inner stream %d", streamID)
+	}
+
+	db.root = &xmlNode{}
+
+	xmlData := bytes.TrimPrefix(payload[len(payload)-src.Len():], []byte("\xef\xbb\xbf"))
+
+	if err = xml.Unmarshal(xmlData, db.root); err != nil { //nolint:musttag // Generic tree.
+		return fmt.Errorf("parse XML: %w", err)
+	}
+
+	return db.root.protect(streamKey, false)
+}
+
+// inner returns the (compressed) inner header and XML.
+func (db *kdbxDB) inner() (_ []byte, err error) {
+	streamKey := make([]byte, kdbxStreamKeySize)
+	rand.Read(streamKey) //nolint:errcheck,gosec // Never fails.
+
+	var buf bytes.Buffer
+
+	kdbxWriteField(&buf, kdbxInnerStreamID, binary.LittleEndian.AppendUint32(nil, kdbxStreamChaCha20))
+	kdbxWriteField(&buf, kdbxInnerStreamKey, streamKey)
+
+	for _, bin := range db.binaries {
+		kdbxWriteField(&buf, kdbxInnerBinary, bin)
+	}
+
+	kdbxWriteField(&buf, kdbxFieldEnd, nil)
+
+	root := db.root.clone()
+	if err = root.protect(streamKey, true); err != nil {
+		return
+	}
+
+	buf.WriteString(xml.Header)
+
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "\t")
+
+	if err = enc.Encode(root); err != nil { //nolint:musttag // Generic tree.
+		return
+	}
+
+	if db.compression != kdbxGzipCompression {
+		return buf.Bytes(), nil
+	}
+
+	var z bytes.Buffer
+
+	zw := gzip.NewWriter(&z)
+	zw.Write(buf.Bytes()) //nolint:errcheck,gosec // Writes to memory.
+
+	if err = zw.Close(); err != nil {
+		return
+	}
+
+	return z.Bytes(), nil
+}
+
+// crypt encrypts or decrypts the payload with the outer cipher.
+func (db *kdbxDB) crypt(key, iv, data []byte, encrypt bool) ([]byte, error) {
+	switch db.cipherID {
+	case kdbxCipherAES:
+		return aesCBC(key, iv, data, encrypt)
+	case kdbxCipherChaCha20:
+		c, err := chacha20.NewUnauthenticatedCipher(key, iv)
+		if err != nil {
+			return nil, err
+		}
+
+		out := make([]byte, len(data))
+		c.XORKeyStream(out, data)
+
+		return out, nil
+	default:
+		return nil, errors.New("unsupported cipher, only AES-256 and ChaCha20 are")
+	}
+}
+
+// transform runs the KDF on the composite key, unless already done for kdf.
+func (k *kdbxKey) transform(kdf kdbxVariant) (out []byte, err error) {
+	params := kdf.bytes()
+	if k.transformed != nil && bytes.Equal(params, k.kdfParams) {
+		return k.transformed, nil
+	}
+
+	salt := kdf.get("S")
+
+	switch uuid := string(kdf.get("$UUID")); uuid {
+	case kdbxKDFAES:
+		if out, err = aesKDF(k.composite, salt, kdf.uint("R")); err != nil {
+			return
+		}
+	case kdbxKDFArgon2d, kdbxKDFArgon2id:
+		iterations, memory, threads := kdf.uint("I"), kdf.uint("M")/1024, kdf.uint("P") //nolint:mnd // KiB
+		if kdf.uint("V") != argon2Version || iterations == 0 || iterations > math.MaxUint32 ||
+			threads == 0 || threads > math.MaxUint8 {
+			return nil, errors.New("unsupported Argon2 parameters")
+		}
+
+		if memory > kdbxMaxArgon2Memory {
+			return nil, fmt.Errorf("unsupported Argon2 memory %d KiB, over %d KiB", memory, kdbxMaxArgon2Memory)
+		}
+
+		if uuid == kdbxKDFArgon2d {
+			out = argon2dKey(k.composite, salt, kdf.get("K"), kdf.get("A"),
+				uint32(iterations), uint32(memory), uint8(threads), sha256.Size)
+
+			break
+		}
+
+		if kdf.get("K") != nil || kdf.get("A") != nil {
+			return nil, errors.New("unsupported Argon2id secret or associated data")
+		}
+
+		out = argon2.IDKey(k.composite, salt, uint32(iterations), uint32(memory), uint8(threads), sha256.Size)
+	default:
+		return nil, errors.New("unsupported KDF, only AES-KDF, Argon2d and Argon2id are")
+	}
+
+	k.kdfParams, k.transformed = params, out
+
+	return
+}
+
+func readKDBXVariant(data []byte) (vars kdbxVariant, err error) {
+	src := bytes.NewReader(data)
+
+	var version uint16
+
+	if err = binary.Read(src, binary.LittleEndian, &version); err != nil || version>>8 != kdbxVariantVersion>>8 {
+		return nil, errors.New("KDF parameters: unsupported format")
+	}
+
+	for {
+		var (
+			name, value []byte
+			typ         byte
+		)
+
+		typ, err = src.ReadByte()
+		if err == nil && typ == kdbxFieldEnd {
+			return vars, nil
+		}
+
+		if err == nil {
+			name, err = kdbxReadBytes(src)
+		}
+
+		if err == nil {
+			value, err = kdbxReadBytes(src)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("KDF parameters: %w", err)
+		}
+
+		vars = append(vars, kdbxVariantItem{name: string(name), value: value, typ: typ})
+	}
+}
+
+func (v *kdbxVariant) bytes() []byte {
+	b := binary.LittleEndian.AppendUint16(nil, kdbxVariantVersion)
+
+	for _, it := range *v {
+		b = append(b, it.typ)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(it.name))) //nolint:gosec // ok
+		b = append(b, it.name...)
+		b = binary.LittleEndian.AppendUint32(b, uint32(len(it.value))) //nolint:gosec // ok
+		b = append(b, it.value...)
+	}
+
+	return append(b, kdbxFieldEnd)
+}
+
+func (v *kdbxVariant) get(name string) []byte {
+	for _, it := range *v {
+		if it.name == name {
+			return it.value
+		}
+	}
+
+	return nil
+}
+
+func (v *kdbxVariant) uint(name string) uint64 {
+	switch val := v.get(name); len(val) {
+	case 4: //nolint:mnd // uint32
+		return uint64(binary.LittleEndian.Uint32(val))
+	case 8: //nolint:mnd // uint64
+		return binary.LittleEndian.Uint64(val)
+	default:
+		return 0
+	}
+}
+
+func (v *kdbxVariant) set(name string, typ byte, value []byte) {
+	for i, it := range *v {
+		if it.name == name {
+			(*v)[i].typ, (*v)[i].value = typ, value
+			return
+		}
+	}
+
+	*v = append(*v, kdbxVariantItem{name: name, value: value, typ: typ})
+}
+
+func newXMLNode(name, content string, nodes ...*xmlNode) *xmlNode {
+	return &xmlNode{XMLName: xml.Name{Local: name}, Content: content, Nodes: nodes}
+}
+
+// child returns the first child element called name, nil if none (or n is nil).
+func (n *xmlNode) child(name string) *xmlNode {
+	if n == nil {
+		return nil
+	}
+
+	for _, c := range n.Nodes {
+		if c.XMLName.Local == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// text returns the content of the child element called name.
+func (n *xmlNode) text(name string) string {
+	if c := n.child(name); c != nil {
+		return c.Content
+	}
+
+	return ""
+}
+
+func (n *xmlNode) attr(name string) string {
+	for _, a := range n.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+
+	return ""
+}
+
+func (n *xmlNode) setAttr(name, value string) {
+	for i, a := range n.Attrs {
+		if a.Name.Local == name {
+			n.Attrs[i].Value = value
+			return
+		}
+	}
+
+	n.Attrs = append(n.Attrs, xml.Attr{Name: xml.Name{Local: name}, Value: value})
+}
+
+func (n *xmlNode) clone() *xmlNode {
+	c := *n
+	c.Attrs = append([]xml.Attr(nil), n.Attrs...)
+	c.Nodes = make([]*xmlNode, len(n.Nodes))
+
+	for i, sub := range n.Nodes {
+		c.Nodes[i] = sub.clone()
+	}
+
+	return &c
+}
+
+// protect encrypts (or decrypts) the Protected="True" values, in document
+// order, with the inner stream. It also drops the indentation around elements.
+func (n *xmlNode) protect(streamKey []byte, encrypt bool) error {
+	h := sha512.Sum512(streamKey)
+
+	stream, err := chacha20.NewUnauthenticatedCipher(h[:chacha20.KeySize], h[chacha20.KeySize:][:chacha20.NonceSize])
+	if err != nil {
+		return err
+	}
+
+	var walk func(n *xmlNode) error
+
+	walk = func(n *xmlNode) error {
+		if len(n.Nodes) > 0 {
+			n.Content = ""
+		}
+
+		if n.attr("Protected") == "True" {
+			if perr := n.protectValue(stream, encrypt); perr != nil {
+				return perr
+			}
+		}
+
+		for _, c := range n.Nodes {
+			if werr := walk(c); werr != nil {
+				return werr
+			}
+		}
+
+		return nil
+	}
+
+	return walk(n)
+}
+
+func (n *xmlNode) protectValue(stream *chacha20.Cipher, encrypt bool) error {
+	if encrypt {
+		val := []byte(n.Content)
+		stream.XORKeyStream(val, val)
+		n.Content = base64.StdEncoding.EncodeToString(val)
+
+		return nil
+	}
+
+	val, err := base64.StdEncoding.DecodeString(strings.TrimSpace(n.Content))
+	if err != nil {
+		return fmt.Errorf("protected value: %w", err)
+	}
+
+	stream.XORKeyStream(val, val)
+	n.Content = string(val)
+
+	return nil
+}
+
+// kdbxKeys derives the payload encryption key and the HMAC base key.
+func kdbxKeys(seed, transformed []byte) (encKey, hmacKey []byte) {
+	enc := sha256.Sum256(append(bytes.Clone(seed), transformed...))
+	mac := sha512.Sum512(append(append(bytes.Clone(seed), transformed...), 1))
+
+	return enc[:], mac[:]
+}
+
+// kdbxHMAC is the HMAC-SHA256 of the block at idx (the header is the
+// kdbxHeaderIndex block), keyed by SHA512(idx || hmacKey).
+func kdbxHMAC(hmacKey []byte, idx uint64, parts ...[]byte) []byte {
+	key := sha512.Sum512(append(binary.LittleEndian.AppendUint64(nil, idx), hmacKey...))
+	mac := hmac.New(sha256.New, key[:])
+
+	for _, p := range parts {
+		mac.Write(p)
+	}
+
+	return mac.Sum(nil)
+}
+
+func kdbxReadBlocks(r *bytes.Reader, hmacKey []byte) (payload []byte, err error) {
+	for idx := uint64(0); ; idx++ {
+		var mac [sha256.Size]byte
+
+		if _, err = io.ReadFull(r, mac[:]); err != nil {
+			return nil, fmt.Errorf("block %d: %w", idx, err)
+		}
+
+		var block []byte
+
+		if block, err = kdbxReadBytes(r); err != nil {
+			return nil, fmt.Errorf("block %d: %w", idx, err)
+		}
+
+		size := binary.LittleEndian.AppendUint32(nil, uint32(len(block))) //nolint:gosec // Read as uint32.
+		if !hmac.Equal(mac[:], kdbxHMAC(hmacKey, idx, binary.LittleEndian.AppendUint64(nil, idx), size, block)) {
+			return nil, fmt.Errorf("block %d: HMAC mismatch, the database is corrupted", idx)
+		}
+
+		if len(block) == 0 {
+			return payload, nil
+		}
+
+		payload = append(payload, block...)
+	}
+}
+
+// kdbxReadField reads a header field: id byte, uint32 size and data.
+func kdbxReadField(r *bytes.Reader) (id byte, data []byte, err error) {
+	if id, err = r.ReadByte(); err != nil {
+		return
+	}
+
+	data, err = kdbxReadBytes(r)
+
+	return
+}
+
+// kdbxReadBytes reads uint32 size prefixed bytes.
+func kdbxReadBytes(r *bytes.Reader) (data []byte, err error) {
+	var size uint32
+
+	if err = binary.Read(r, binary.LittleEndian, &size); err != nil {
+		return
+	}
+
+	if int64(size) > int64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	data = make([]byte, size)
+	_, err = io.ReadFull(r, data)
+
+	return
+}
+
+func kdbxWriteField(w *bytes.Buffer, id byte, data []byte) {
+	w.WriteByte(id)
+	w.Write(binary.LittleEndian.AppendUint32(nil, uint32(len(data)))) //nolint:gosec // ok
+	w.Write(data)
+}
+
+// kdbxTime is the current time in the KDBX 4 format: base64 of the little
+// endian int64 seconds since 0001-01-01.
+func kdbxTime() string {
+	secs := uint64(time.Now().Unix() + kdbxEpoch) //nolint:gosec // After year 1.
+	return base64.StdEncoding.EncodeToString(binary.LittleEndian.AppendUint64(nil, secs))
+}
+
+func kdbxTimes(now string) *xmlNode {
+	return newXMLNode("Times", "",
+		newXMLNode("LastModificationTime", now), newXMLNode("CreationTime", now),
+		newXMLNode("LastAccessTime", now), newXMLNode("ExpiryTime", now),
+		newXMLNode("Expires", "False"), newXMLNode("UsageCount", "0"),
+		newXMLNode("LocationChanged", now))
+}
+
+func kdbxUUID() string {
+	id := make([]byte, 16) //nolint:mnd // UUID size
+	rand.Read(id)          //nolint:errcheck,gosec // Never fails.
+
+	return base64.StdEncoding.EncodeToString(id)
+}
+
+func aesKDF(composite, seed []byte, rounds uint64) ([]byte, error) {
+	block, err := aes.NewCipher(seed)
+	if err != nil {
+		return nil, fmt.Errorf("AES-KDF: %w", err)
+	}
+
+	key := bytes.Clone(composite)
+
+	for range rounds {
+		block.Encrypt(key[:aes.BlockSize], key[:aes.BlockSize])
+		block.Encrypt(key[aes.BlockSize:], key[aes.BlockSize:])
+	}
+
+	sum := sha256.Sum256(key)
+
+	return sum[:], nil
+}
+
+// aesCBC is AES-256-CBC with PKCS#7 padding.
+func aesCBC(key, iv, data []byte, encrypt bool) ([]byte, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(iv) != aes.BlockSize {
+		return nil, errors.New("bad AES IV size")
+	}
+
+	if encrypt {
+		pad := aes.BlockSize - len(data)%aes.BlockSize
+		data = append(bytes.Clone(data), bytes.Repeat([]byte{byte(pad)}, pad)...)
+		cipher.NewCBCEncrypter(block, iv).CryptBlocks(data, data)
+
+		return data, nil
+	}
+
+	if len(data) == 0 || len(data)%aes.BlockSize != 0 {
+		return nil, errKDBXKey
+	}
+
+	out := make([]byte, len(data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(out, data)
+
+	pad := int(out[len(out)-1])
+	if pad == 0 || pad > aes.BlockSize || !bytes.Equal(out[len(out)-pad:], bytes.Repeat([]byte{byte(pad)}, pad)) {
+		return nil, errKDBXKey
+	}
+
+	return out[:len(out)-pad], nil
+}
+
+func gunzip(data []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	return io.ReadAll(zr)
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testKDBXParams are cheap parameters for the given KDF.
+func testKDBXParams(uuid string) kdbxVariant {
+	kdf := kdbxArgon2Params(2, 64<<10, 2)
+	kdf.set("$UUID", kdbxTypeBytes, []byte(uuid))
+
+	if uuid == kdbxKDFAES {
+		kdf = kdbxVariant{}
+		kdf.set("$UUID", kdbxTypeBytes, []byte(uuid))
+		kdf.set("R", kdbxTypeUInt64, binary.LittleEndian.AppendUint64(nil, 100))
+		kdf.set("S", kdbxTypeBytes, bytes.Repeat([]byte{7}, kdbxSeedSize))
+	}
+
+	return kdf
+}
+
+func TestKDBXRoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		cipherID    string
+		kdf         string
+		compression uint32
+	}{
+		{name: "aes argon2id gzip", cipherID: kdbxCipherAES, kdf: kdbxKDFArgon2id, compression: kdbxGzipCompression},
+		{name: "chacha20 argon2d", cipherID: kdbxCipherChaCha20, kdf: kdbxKDFArgon2d},
+		{name: "aes aes-kdf", cipherID: kdbxCipherAES, kdf: kdbxKDFAES},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			key, _ := newKDBXKey("hunter2", nil) //nolint:errcheck // ok
+
+			db := newKDBX(testKDBXParams(tt.kdf))
+			db.key, db.cipherID, db.compression = key, tt.cipherID, tt.compression
+			db.binaries = [][]byte{{1, 'b', 'i', 'n'}}
+			db.setEntry(keyringService, "p", `{"Version":1}`)
+			db.setEntry("team/awbus", "q", "secret")
+
+			raw, err := db.encode()
+			if err != nil {
+				t.Fatalf("encode() error = %v", err)
+			}
+
+			if bytes.Contains(raw, []byte("Version")) || bytes.Contains(raw, []byte("secret")) {
+				t.Error("database is not encrypted")
+			}
+
+			fresh, _ := newKDBXKey("hunter2", nil) //nolint:errcheck // ok
+
+			got, err := readKDBX(raw, fresh)
+			if err != nil {
+				t.Fatalf("readKDBX() error = %v", err)
+			}
+
+			if pw := kdbxField(kdbxEntry(got.group("team/awbus", false), "q"), "Password"); pw.Content != "secret" ||
+				pw.attr("Protected") != "True" {
+				t.Errorf("entry password = %q, protected %q", pw.Content, pw.attr("Protected"))
+			}
+
+			if got.cipherID != tt.cipherID || got.compression != tt.compression || len(got.binaries) != 1 {
+				t.Errorf("settings not kept: cipher %x, compression %d, binaries %d",
+					got.cipherID, got.compression, len(got.binaries))
+			}
+
+			wrong, _ := newKDBXKey("hunter3", nil) //nolint:errcheck // ok
+			if _, err = readKDBX(raw, wrong); !errors.Is(err, errKDBXKey) {
+				t.Errorf("readKDBX() with wrong password error = %v, want %v", err, errKDBXKey)
+			}
+		})
+	}
+}
+
+func TestKDBXPreservesForeignData(t *testing.T) {
+	key, _ := newKDBXKey("hunter2", nil) //nolint:errcheck // ok
+
+	db := newKDBX(testKDBXParams(kdbxKDFArgon2id))
+	db.key = key
+	db.setEntry("Personal", "mail", "p@ss")
+
+	mail := kdbxEntry(db.group("Personal", false), "mail")
+	mail.Nodes = append(mail.Nodes, kdbxString("URL", "https://mail.example.com"),
+		newXMLNode("History", "", newXMLNode("Entry", "", kdbxString("Password", "old"))))
+	mail.Nodes[len(mail.Nodes)-1].Nodes[0].Nodes[0].child("Value").setAttr("Protected", "True")
+
+	raw, err := db.encode()
+	if err != nil {
+		t.Fatalf("encode() error = %v", err)
+	}
+
+	if db, err = readKDBX(raw, key); err != nil {
+		t.Fatalf("readKDBX() error = %v", err)
+	}
+
+	db.setEntry(keyringService, "p", "v")
+
+	if !db.deleteEntry(keyringService, "p") || db.deleteEntry(keyringService, "p") {
+		t.Error("deleteEntry() should only succeed once")
+	}
+
+	if raw, err = db.encode(); err != nil {
+		t.Fatalf("encode() error = %v", err)
+	}
+
+	if db, err = readKDBX(raw, key); err != nil {
+		t.Fatalf("readKDBX() error = %v", err)
+	}
+
+	mail = kdbxEntry(db.group("Personal", false), "mail")
+	if kdbxField(mail, "URL").Content != "https://mail.example.com" || kdbxField(mail, "Password").Content != "p@ss" ||
+		kdbxField(mail.child("History").child("Entry"), "Password").Content != "old" {
+		t.Errorf("foreign entry not preserved: %+v", mail)
+	}
+
+	if deleted := db.root.child("Root").child("DeletedObjects"); len(deleted.Nodes) != 1 {
+		t.Errorf("DeletedObjects = %d, want 1", len(deleted.Nodes))
+	}
+}
+
+func TestKDBXKeyFileKey(t *testing.T) {
+	key := bytes.Repeat([]byte{0xab}, 32)
+
+	tests := []struct {
+		name    string
+		raw     string
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "xml v1",
+			raw: `<KeyFile><Meta><Version>1.00</Version></Meta>` +
+				`<Key><Data>q6urq6urq6urq6urq6urq6urq6urq6urq6urq6urq6s=</Data></Key></KeyFile>`,
+			want: key,
+		},
+		{
+			name: "xml v2",
+			raw: `<?xml version="1.0" encoding="utf-8"?><KeyFile><Meta><Version>2.0</Version></Meta><Key>` +
+				`<Data Hash="9A2DB2E2">ABABABAB ABABABAB ABABABAB ABABABAB` + "\n" + //nolint:dupword // ok
+				`ABABABAB ABABABAB ABABABAB ABABABAB</Data></Key></KeyFile>`, //nolint:dupword // ok
+			want: key,
+		},
+		{
+			name: "xml v2 bad hash",
+			raw: `<KeyFile><Meta><Version>2.0</Version></Meta><Key>` +
+				`<Data Hash="00000000">ABABABABABABABABABABABABABABABABABABABABABABABABABABABABABABABAB</Data></Key></KeyFile>`,
+			wantErr: true,
+		},
+		{name: "raw", raw: string(key), want: key},
+		{name: "hex", raw: strings.Repeat("ab", 32), want: key},
+		{name: "other", raw: "abc", want: []byte{
+			0xba, 0x78, 0x16, 0xbf, 0x8f, 0x01, 0xcf, 0xea, 0x41, 0x41, 0x40, 0xde, 0x5d, 0xae, 0x22, 0x23,
+			0xb0, 0x03, 0x61, 0xa3, 0x96, 0x17, 0x7a, 0x9c, 0xb4, 0x10, 0xff, 0x61, 0xf2, 0x00, 0x15, 0xad,
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := kdbxKeyFileKey([]byte(tt.raw))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("kdbxKeyFileKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("kdbxKeyFileKey() = %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadKDBXErrors(t *testing.T) {
+	key, _ := newKDBXKey("hunter2", nil) //nolint:errcheck // ok
+
+	db := newKDBX(testKDBXParams(kdbxKDFAES))
+	db.key = key
+
+	raw, err := db.encode()
+	if err != nil {
+		t.Fatalf("encode() error = %v", err)
+	}
+
+	kdbx3 := bytes.Clone(raw)
+	binary.LittleEndian.PutUint32(kdbx3[8:], 0x00030001)
+
+	corrupt := bytes.Clone(raw)
+	corrupt[len(corrupt)-40] ^= 1
+
+	tests := []struct {
+		name string
+		want string
+		raw  []byte
+	}{
+		{name: "not kdbx", raw: []byte("hello, world"), want: "not a KeePass database"},
+		{name: "kdbx 3", raw: kdbx3, want: "unsupported KDBX version 3.1"},
+		{name: "corrupted", raw: corrupt, want: "HMAC mismatch"},
+		{name: "truncated", raw: raw[:200], want: "EOF"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, rerr := readKDBX(tt.raw, key); rerr == nil || !strings.Contains(rerr.Error(), tt.want) {
+				t.Errorf("readKDBX() error = %v, want %q", rerr, tt.want)
+			}
+		})
+	}
+}
+
+func TestKDBXKeyTransformArgon2Limits(t *testing.T) {
+	key, _ := newKDBXKey("hunter2", nil) //nolint:errcheck // ok
+
+	for name, tt := range map[string]struct {
+		want string
+		kdf  kdbxVariant
+	}{
+		"no iterations": {"unsupported Argon2 parameters", kdbxArgon2Params(0, 64<<10, 2)},
+		"huge memory":   {"unsupported Argon2 memory", kdbxArgon2Params(2, 1<<40, 2)},
+	} {
+		for _, uuid := range []string{kdbxKDFArgon2d, kdbxKDFArgon2id} {
+			tt.kdf.set("$UUID", kdbxTypeBytes, []byte(uuid))
+
+			if _, err := key.transform(tt.kdf); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("transform(%s) error = %v, want %q", name, err, tt.want)
+			}
+		}
+	}
+}
+
+func TestKDBXInnerStream(t *testing.T) {
+	for id, want := range map[uint32]string{kdbxStreamSalsa20: "Salsa20, only ChaCha20", 9: "inner stream 9"} {
+		var buf bytes.Buffer
+
+		kdbxWriteField(&buf, kdbxInnerStreamID, binary.LittleEndian.AppendUint32(nil, id))
+		kdbxWriteField(&buf, kdbxFieldEnd, nil)
+		buf.WriteString("<KeePassFile/>")
+
+		if err := (&kdbxDB{}).readInner(buf.Bytes()); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("readInner(stream %d) error = %v, want %q", id, err, want)
+		}
+	}
+}
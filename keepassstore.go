@@ -0,0 +1,301 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// keepassStore keeps secrets in a KeePass (KDBX 4) database, e.g. one shared
+// with KeePassXC. Each service is a group under the root group and each
+// username the Title of an entry in it, with the secret as its (protected)
+// Password, so profiles are the entries of the awbus group. The database is
+// unlocked with the master password and, optionally, a key file.
+type keepassStore struct {
+	passphraseSource
+
+	key     *kdbxKey
+	path    string
+	keyFile string
+	kdf     kdbxVariant // For new databases.
+}
+
+const (
+	backendKeepass        = "keepass"
+	defaultKeepassMemory  = 64 << 20
+	defaultKeepassPasses  = 3
+	defaultKeepassThreads = 4
+)
+
+func newKeepassStore(cfg *config, prompt func(label string, val *string) error) (s *keepassStore, err error) {
+	s = &keepassStore{
+		passphraseSource: newPassphraseSource(cfg, prompt),
+		path:             cfg.AwbusKeepassFile,
+		keyFile:          cfg.AwbusKeepassKeyfile,
+		kdf:              kdbxArgon2Params(defaultKeepassPasses, defaultKeepassMemory, defaultKeepassThreads),
+	}
+
+	if s.path == "" {
+		var dir string
+
+		if dir, err = os.UserConfigDir(); err != nil {
+			return nil, fmt.Errorf("keepass backend: %w", err)
+		}
+
+		s.path = filepath.Join(dir, keyringService, keyringService+".kdbx")
+	}
+
+	s.label = "Master password for " + s.path
+
+	return
+}
+
+func (s *keepassStore) Get(service, username string) (string, error) {
+	db, err := s.read()
+	if err != nil {
+		return "", err
+	}
+
+	entry := kdbxEntry(db.group(service, false), username)
+	if entry == nil {
+		return "", fmt.Errorf("%s/%s: %w", service, username, errNotFound)
+	}
+
+	return kdbxField(entry, "Password").Content, nil
+}
+
+func (s *keepassStore) Set(service, username, secret string) error {
+	return s.update(func(db *kdbxDB) error {
+		db.setEntry(service, username, secret)
+		return nil
+	})
+}
+
+func (s *keepassStore) Delete(service, username string) error {
+	return s.update(func(db *kdbxDB) error {
+		if !db.deleteEntry(service, username) {
+			return fmt.Errorf("%s/%s: %w", service, username, errNotFound)
+		}
+
+		return nil
+	})
+}
+
+func (s *keepassStore) List(service string) (names []string, err error) {
+	db, err := s.read()
+	if err != nil {
+		return
+	}
+
+	if g := db.group(service, false); g != nil {
+		for _, e := range g.Nodes {
+			if e.XMLName.Local == "Entry" {
+				names = append(names, kdbxField(e, "Title").Content)
+			}
+		}
+	}
+
+	slices.Sort(names)
+
+	return
+}
+
+// update applies fn to the database under the file lock.
+func (s *keepassStore) update(fn func(*kdbxDB) error) (err error) {
+	if err = os.MkdirAll(filepath.Dir(s.path), privateDirMode); err != nil {
+		return
+	}
+
+	unlock, err := lockFile(s.path+".lock", lockTimeout)
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	db, err := s.read()
+	if err != nil {
+		return
+	}
+
+	if err = fn(db); err != nil {
+		return
+	}
+
+	if db.key == nil { // A new database.
+		if db.key, err = s.getKey(true); err != nil {
+			return
+		}
+	}
+
+	raw, err := db.encode()
+	if err != nil {
+		return
+	}
+
+	return writeFileAtomic(s.path, raw)
+}
+
+// read opens the database, or returns a new, empty one if there is none yet.
+func (s *keepassStore) read() (db *kdbxDB, err error) {
+	raw, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return newKDBX(s.kdf), nil
+	} else if err != nil {
+		return
+	}
+
+	key, err := s.getKey(false)
+	if err != nil {
+		return
+	}
+
+	if db, err = readKDBX(raw, key); err != nil {
+		return nil, fmt.Errorf("open %s: %w", s.path, err)
+	}
+
+	return
+}
+
+// getKey gets the composite key, with a new master password when create is
+// set.
+func (s *keepassStore) getKey(create bool) (_ *kdbxKey, err error) {
+	if s.key != nil {
+		return s.key, nil
+	}
+
+	var keyFile []byte
+
+	if s.keyFile != "" {
+		if keyFile, err = os.ReadFile(s.keyFile); err != nil {
+			return
+		}
+	}
+
+	pass, err := s.getPassphrase(create)
+	if err != nil {
+		return
+	}
+
+	s.key, err = newKDBXKey(pass, keyFile)
+
+	return s.key, err
+}
+
+// group returns the group at path (slash separated) under the root group,
+// creating it when missing if create is set.
+func (db *kdbxDB) group(path string, create bool) *xmlNode {
+	g := db.root.child("Root").child("Group")
+
+	for name := range strings.SplitSeq(path, "/") {
+		if g == nil {
+			return nil
+		}
+
+		i := slices.IndexFunc(g.Nodes, func(n *xmlNode) bool {
+			return n.XMLName.Local == "Group" && n.text("Name") == name
+		})
+		if i >= 0 {
+			g = g.Nodes[i]
+			continue
+		}
+
+		if !create {
+			return nil
+		}
+
+		sub := newXMLNode("Group", "", newXMLNode("UUID", kdbxUUID()), newXMLNode("Name", name),
+			kdbxTimes(kdbxTime()), newXMLNode("IsExpanded", "True"))
+		g.Nodes = append(g.Nodes, sub)
+		g = sub
+	}
+
+	return g
+}
+
+func (db *kdbxDB) setEntry(service, username, secret string) {
+	g := db.group(service, true)
+	now := kdbxTime()
+
+	entry := kdbxEntry(g, username)
+	if entry == nil {
+		entry = newXMLNode("Entry", "", newXMLNode("UUID", kdbxUUID()), kdbxTimes(now),
+			kdbxString("Title", username), kdbxString("Password", ""))
+
+		// Entries go before the subgroups, as KeePass writes them.
+		i := slices.IndexFunc(g.Nodes, func(n *xmlNode) bool { return n.XMLName.Local == "Group" })
+		if i < 0 {
+			i = len(g.Nodes)
+		}
+
+		g.Nodes = slices.Insert(g.Nodes, i, entry)
+	}
+
+	pw := kdbxField(entry, "Password")
+	if pw.XMLName.Local == "" {
+		str := kdbxString("Password", "")
+		entry.Nodes = append(entry.Nodes, str)
+		pw = str.child("Value")
+	}
+
+	pw.Content = secret
+	pw.setAttr("Protected", "True")
+
+	if mod := entry.child("Times").child("LastModificationTime"); mod != nil {
+		mod.Content = now
+	}
+}
+
+// deleteEntry removes the entry and records it as deleted, for KeePass sync.
+func (db *kdbxDB) deleteEntry(service, username string) bool {
+	g := db.group(service, false)
+
+	entry := kdbxEntry(g, username)
+	if entry == nil {
+		return false
+	}
+
+	g.Nodes = slices.DeleteFunc(g.Nodes, func(n *xmlNode) bool { return n == entry })
+
+	if deleted := db.root.child("Root").child("DeletedObjects"); deleted != nil {
+		deleted.Nodes = append(deleted.Nodes, newXMLNode("DeletedObject", "",
+			newXMLNode("UUID", entry.text("UUID")), newXMLNode("DeletionTime", kdbxTime())))
+	}
+
+	return true
+}
+
+// kdbxEntry returns the entry of group g titled title, nil if none.
+func kdbxEntry(g *xmlNode, title string) *xmlNode {
+	if g == nil {
+		return nil
+	}
+
+	for _, n := range g.Nodes {
+		if n.XMLName.Local == "Entry" && kdbxField(n, "Title").Content == title {
+			return n
+		}
+	}
+
+	return nil
+}
+
+// kdbxField returns the Value of the entry's key string field, an empty
+// node if missing.
+func kdbxField(entry *xmlNode, key string) *xmlNode {
+	for _, n := range entry.Nodes {
+		if n.XMLName.Local == "String" && n.text("Key") == key {
+			if v := n.child("Value"); v != nil {
+				return v
+			}
+		}
+	}
+
+	return &xmlNode{}
+}
+
+func kdbxString(key, value string) *xmlNode {
+	return newXMLNode("String", "", newXMLNode("Key", key), newXMLNode("Value", value))
+}
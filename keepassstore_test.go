@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func newTestKeepassStore(t *testing.T, cfg *config) *keepassStore {
+	t.Helper()
+
+	if cfg.AwbusKeepassFile == "" {
+		cfg.AwbusKeepassFile = filepath.Join(t.TempDir(), "awbus", "awbus.kdbx")
+	}
+
+	st, err := newKeepassStore(cfg, func(string, *string) error { return errors.New("no terminal") })
+	if err != nil {
+		t.Fatalf("newKeepassStore() error = %v", err)
+	}
+
+	st.kdf = testKDBXParams(kdbxKDFArgon2d)
+
+	return st
+}
+
+func TestKeepassStore(t *testing.T) {
+	st := newTestKeepassStore(t, &config{AwbusPassphrase: "hunter2"})
+
+	if _, err := st.Get(keyringService, "p"); !errors.Is(err, errNotFound) {
+		t.Errorf("Get() on missing file error = %v, want %v", err, errNotFound)
+	}
+
+	for _, name := range []string{"b", "a"} {
+		if err := st.Set(keyringService, name, `{"Version":1,"Profile":"`+name+`"}`); err != nil {
+			t.Fatalf("Set(%s) error = %v", name, err)
+		}
+	}
+
+	if err := st.Set(keyringService, "a", "value-a"); err != nil {
+		t.Fatalf("Set() overwrite error = %v", err)
+	}
+
+	if got, err := st.Get(keyringService, "a"); err != nil || got != "value-a" {
+		t.Errorf("Get() = %s, %v", got, err)
+	}
+
+	if got, err := st.List(keyringService); err != nil || !slices.Equal(got, []string{"a", "b"}) {
+		t.Errorf("List() = %v, %v", got, err)
+	}
+
+	if err := st.Delete(keyringService, "a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if err := st.Delete(keyringService, "a"); !errors.Is(err, errNotFound) {
+		t.Errorf("Delete() twice error = %v, want %v", err, errNotFound)
+	}
+
+	if raw, err := os.ReadFile(st.path); err != nil || strings.Contains(string(raw), "Profile") {
+		t.Errorf("database is not encrypted: %v", err)
+	}
+
+	other := newTestKeepassStore(t, &config{AwbusKeepassFile: st.path, AwbusPassphrase: "hunter3"})
+	if _, err := other.Get(keyringService, "b"); !errors.Is(err, errKDBXKey) {
+		t.Errorf("Get() with wrong password error = %v, want %v", err, errKDBXKey)
+	}
+
+	other = newTestKeepassStore(t, &config{AwbusKeepassFile: st.path, AwbusPassphrase: "hunter2"})
+	if got, err := other.Get(keyringService, "b"); err != nil || got != `{"Version":1,"Profile":"b"}` {
+		t.Errorf("Get() from fresh store = %s, %v", got, err)
+	}
+}
+
+func TestKeepassStoreKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "awbus.keyx")
+
+	os.WriteFile(keyFile, []byte("any file can be a key file"), privateFileMode) //nolint:errcheck,gosec // ok
+
+	cfg := config{
+		AwbusKeepassFile:    filepath.Join(dir, "awbus.kdbx"),
+		AwbusPassphrase:     "hunter2",
+		AwbusKeepassKeyfile: keyFile,
+	}
+
+	if err := newTestKeepassStore(t, &cfg).Set("svc", "user", "secret"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if got, err := newTestKeepassStore(t, &cfg).Get("svc", "user"); err != nil || got != "secret" {
+		t.Errorf("Get() = %s, %v", got, err)
+	}
+
+	cfg.AwbusKeepassKeyfile = ""
+	if _, err := newTestKeepassStore(t, &cfg).Get("svc", "user"); !errors.Is(err, errKDBXKey) {
+		t.Errorf("Get() without key file error = %v, want %v", err, errKDBXKey)
+	}
+
+	cfg.AwbusKeepassKeyfile = filepath.Join(dir, "missing.keyx")
+	if _, err := newTestKeepassStore(t, &cfg).Get("svc", "user"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Get() with missing key file error = %v, want %v", err, os.ErrNotExist)
+	}
+}
+
+func TestKeepassStoreNewPassword(t *testing.T) {
+	st := newTestKeepassStore(t, &config{})
+
+	var labels []string
+
+	st.prompt = func(label string, val *string) error {
+		labels = append(labels, label)
+		*val = label // Mistyped, the second time.
+
+		return nil
+	}
+
+	if err := st.Set("svc", "user", "secret"); err == nil || !strings.Contains(err.Error(), "do not match") {
+		t.Errorf("Set() error = %v, want a mismatch", err)
+	}
+
+	if _, err := os.Stat(st.path); !errors.Is(err, os.ErrNotExist) || len(labels) != 2 {
+		t.Errorf("database stat error = %v, prompted %q, want none created after two prompts", err, labels)
+	}
+}
+
+// TestKeepassStoreKeePassXC opens the databases KeePassXC created (see
+// testdata/keepassxc/README.md), changes them and reopens what awbus wrote.
+func TestKeepassStoreKeePassXC(t *testing.T) {
+	dir := filepath.Join("testdata", "keepassxc")
+
+	for _, tt := range []struct{ file, keyFile string }{
+		{file: "argon2d-chacha20.kdbx"},
+		{file: "aeskdf-aes.kdbx"},
+		{file: "argon2id-aes-keyfile.kdbx", keyFile: "keyfile.keyx"},
+	} {
+		t.Run(tt.file, func(t *testing.T) {
+			raw, err := os.ReadFile(filepath.Join(dir, tt.file)) //nolint:gosec // ok
+			if errors.Is(err, os.ErrNotExist) {
+				t.Skipf("no %s, see %s", tt.file, filepath.Join(dir, "README.md"))
+			} else if err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := config{AwbusPassphrase: "awbus-test", AwbusKeepassFile: filepath.Join(t.TempDir(), tt.file)}
+			if tt.keyFile != "" {
+				cfg.AwbusKeepassKeyfile = filepath.Join(dir, tt.keyFile)
+			}
+
+			if err = os.WriteFile(cfg.AwbusKeepassFile, raw, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			const profile = `{"Version":2,"AccessKeyId":"AKIA","SecretAccessKey":"s"}`
+
+			orig, want := keepassEntries(t, newTestKeepassStore(t, &cfg))
+			if want["awbus/p"] != profile || want["Other/Sample"] != "sample" {
+				t.Fatalf("entries = %q", want)
+			}
+
+			if err = newTestKeepassStore(t, &cfg).Set(keyringService, "q", "new"); err != nil {
+				t.Fatal(err)
+			}
+
+			want["awbus/q"] = "new"
+
+			db, got := keepassEntries(t, newTestKeepassStore(t, &cfg))
+			if !maps.Equal(got, want) {
+				t.Errorf("entries after writing = %q, want %q", got, want)
+			}
+
+			if db.cipherID != orig.cipherID || !bytes.Equal(db.kdf.get("$UUID"), orig.kdf.get("$UUID")) {
+				t.Errorf("cipher %x, KDF %x not kept", db.cipherID, db.kdf.get("$UUID"))
+			}
+		})
+	}
+}
+
+// keepassEntries reads the database and its entries, as group/title paths
+// (under the root group) to passwords.
+func keepassEntries(t *testing.T, st *keepassStore) (db *kdbxDB, entries map[string]string) {
+	t.Helper()
+
+	db, err := st.read()
+	if err != nil {
+		t.Fatalf("read() error = %v", err)
+	}
+
+	entries = map[string]string{}
+
+	var walk func(g *xmlNode, path string)
+
+	walk = func(g *xmlNode, path string) {
+		for _, n := range g.Nodes {
+			switch n.XMLName.Local {
+			case "Entry":
+				entries[path+kdbxField(n, "Title").Content] = kdbxField(n, "Password").Content
+			case "Group":
+				walk(n, path+n.text("Name")+"/")
+			}
+		}
+	}
+
+	walk(db.root.child("Root").child("Group"), "")
+
+	return
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// profileInfo is a profile summary, as printed by list. TTL is the time left
+// until Expiration, zero once expired.
+type profileInfo struct { //nolint:govet // ok
+	Name          string        `json:"Name"`
+	Type          string        `json:"Type"`
+	RoleArn       string        `json:"RoleArn,omitempty"`
+	SourceProfile string        `json:"SourceProfile,omitempty"`
+	Expiration    time.Time     `json:"Expiration,omitzero"`
+	TTL           time.Duration `json:"TTL,omitzero,format:units"` //nolint:tagliatelle // ok
+}
+
+// list prints the stored profiles, as a table or, with --json, a JSON array.
+func (a *app) list(w io.Writer, args []string, now time.Time) (err error) {
+	var asJSON bool
+
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.BoolVar(&asJSON, "json", false, "print JSON")
+
+	if err = flags.Parse(args); err != nil {
+		return fmt.Errorf("list: %w", err)
+	}
+
+	a.backfillIndex(a.store)
+
+	names, err := a.store.List(keyringService)
+	if err != nil {
+		return
+	}
+
+	infos := make([]profileInfo, 0, len(names))
+
+	for _, name := range names {
+		var info profileInfo
+
+		if info, err = a.profileInfo(name, now); err != nil {
+			return
+		}
+
+		infos = append(infos, info)
+	}
+
+	if asJSON {
+		return json.MarshalWrite(w, infos, jsontext.WithIndent("  "))
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tTYPE\tROLE ARN\tSOURCE PROFILE\tEXPIRATION\tTTL") //nolint:errcheck // Checked by Flush.
+
+	for _, info := range infos {
+		expiration, ttl := "-", "-"
+
+		switch {
+		case info.Expiration.IsZero():
+		case info.TTL == 0:
+			expiration, ttl = info.Expiration.Format(time.RFC3339), "expired"
+		default:
+			expiration, ttl = info.Expiration.Format(time.RFC3339), info.TTL.String()
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", //nolint:errcheck // Checked by Flush.
+			info.Name, info.Type, cmp.Or(info.RoleArn, "-"), cmp.Or(info.SourceProfile, "-"), expiration, ttl)
+	}
+
+	return tw.Flush()
+}
+
+// profileInfo summarizes the profile, with the expiration of its cached
+// session, if any.
+func (a *app) profileInfo(name string, now time.Time) (info profileInfo, err error) {
+	var c Creds
+
+	if err = c.load(a.store, name); err != nil {
+		return info, fmt.Errorf("profile %q: %w", name, err)
+	}
+
+	if c.cachesSession() {
+		var session Creds
+
+		if err = session.loadSession(a.store, name); err != nil && !errors.Is(err, errNotFound) {
+			return info, fmt.Errorf("profile %q session: %w", name, err)
+		}
+
+		c.Expiration, err = session.Expiration, nil
+	}
+
+	info = profileInfo{
+		Name: name, Type: c.kind(), RoleArn: c.RoleArn, SourceProfile: c.SourceProfile,
+		Expiration: c.Expiration,
+	}
+
+	if !c.Expiration.IsZero() {
+		info.TTL = max(c.Expiration.Sub(now), 0).Round(time.Second)
+	}
+
+	return
+}
+
+// kind is the profile type: static, role, web-identity or sso.
+func (c *Creds) kind() string {
+	switch {
+	case c.isSSO():
+		return "sso"
+	case c.isWebIdentity():
+		return "web-identity"
+	case c.isStatic():
+		return "static"
+	default:
+		return "role"
+	}
+}
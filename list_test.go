@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json/v2"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestAppList(t *testing.T) { //nolint:funlen // ok
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	keyring.MockInit()
+
+	st := keyringStore{}
+	for _, it := range []struct{ service, username, secret string }{
+		{keyringService, "static", `{"Version":1,"AccessKeyId":"AKIA","SecretAccessKey":"s"}`},
+		{keyringService, "mfa", `{"Version":1,"AccessKeyId":"AKIA","SecretAccessKey":"s","UseSessionToken":true}`},
+		{sessionService, "mfa", `{"Version":1,"Expiration":"2025-01-15T10:30:00Z"}`},
+		{keyringService, "role", `{"Version":1,"RoleArn":"arn:role","SourceProfile":"static"}`},
+		{sessionService, "role", `{"Version":1,"Expiration":"2025-01-15T09:00:00Z"}`},
+		{keyringService, "ci", `{"Version":1,"RoleArn":"arn:ci","WebIdentityTokenFile":"/token"}`},
+		{keyringService, "sso", `{"Version":1,"SsoStartUrl":"https://x.awsapps.com/start",` +
+			`"AccessKeyId":"ASIA","SecretAccessKey":"s","Expiration":"2025-01-15T11:00:01Z"}`}, // Stored with its session.
+	} {
+		if err := st.Set(it.service, it.username, it.secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ap := app{store: st}
+
+	t.Run("table", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		if err := ap.list(&buf, nil, now); err != nil {
+			t.Fatalf("list() error = %v", err)
+		}
+
+		//nolint:dupword // ok
+		want := `NAME    TYPE          ROLE ARN  SOURCE PROFILE  EXPIRATION            TTL
+ci      web-identity  arn:ci    -               -                     -
+mfa     static        -         -               2025-01-15T10:30:00Z  30m0s
+role    role          arn:role  static          2025-01-15T09:00:00Z  expired
+sso     sso           -         -               2025-01-15T11:00:01Z  1h0m1s
+static  static        -         -               -                     -
+`
+		if got := buf.String(); got != want {
+			t.Errorf("list() =\n%s\nwant\n%s", got, want)
+		}
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var buf bytes.Buffer
+
+		if err := ap.list(&buf, []string{"--json"}, now); err != nil {
+			t.Fatalf("list() error = %v", err)
+		}
+
+		var got []profileInfo
+
+		if err := json.Unmarshal(buf.Bytes(), &got); err != nil {
+			t.Fatalf("list() output %s: %v", buf.String(), err)
+		}
+
+		if len(got) != 5 || got[1].Name != "mfa" || got[1].TTL != 30*time.Minute || got[2].RoleArn != "arn:role" {
+			t.Errorf("list() = %+v", got)
+		}
+
+		if !strings.Contains(buf.String(), `"TTL": "30m0s"`) {
+			t.Errorf("list() = %s, want TTL in units", buf.String())
+		}
+	})
+
+	t.Run("unknown flag", func(t *testing.T) {
+		if err := ap.list(&bytes.Buffer{}, []string{"--yaml"}, now); err == nil {
+			t.Error("list() error = nil, want error")
+		}
+	})
+
+	t.Run("broken profile", func(t *testing.T) {
+		if err := st.Set(keyringService, "broken", "{"); err != nil {
+			t.Fatal(err)
+		}
+
+		defer st.Delete(keyringService, "broken") //nolint:errcheck // ok
+
+		if err := ap.list(&bytes.Buffer{}, nil, now); err == nil || !strings.Contains(err.Error(), `"broken"`) {
+			t.Errorf("list() error = %v, want broken profile", err)
+		}
+	})
+}
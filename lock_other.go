@@ -0,0 +1,42 @@
+//go:build !unix && !windows
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// staleLockAge is how old a lock file must be to be taken for one left
+// behind by a process that died holding it.
+const staleLockAge = 10 * time.Minute
+
+// lockFile takes an exclusive lock on path by creating it, waiting up to
+// timeout; unlock removes it. Stale lock files are removed.
+func lockFile(path string, timeout time.Duration) (unlock func(), err error) {
+	deadline := time.Now().Add(timeout)
+
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, privateFileMode) //nolint:gosec // ok
+		if err == nil {
+			f.Close() //nolint:errcheck,gosec // ok
+
+			return func() {
+				os.Remove(path) //nolint:errcheck,gosec // ok
+			}, nil
+		}
+
+		if fi, serr := os.Stat(path); serr == nil && time.Since(fi.ModTime()) > staleLockAge {
+			os.Remove(path) //nolint:errcheck,gosec // Left by a dead process.
+			continue
+		}
+
+		if !errors.Is(err, os.ErrExist) || time.Now().After(deadline) {
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+
+		time.Sleep(lockPollInterval)
+	}
+}
@@ -0,0 +1,38 @@
+//go:build unix
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+)
+
+// lockFile takes an exclusive flock on path, waiting up to timeout.
+func lockFile(path string, timeout time.Duration) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, privateFileMode) //nolint:gosec // ok
+	if err != nil {
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+
+	fd := int(f.Fd())
+	deadline := time.Now().Add(timeout)
+
+	for {
+		if err = syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB); err == nil {
+			return func() {
+				syscall.Flock(fd, syscall.LOCK_UN) //nolint:errcheck,gosec // Released on close anyway.
+				f.Close()                          //nolint:errcheck,gosec // ok
+			}, nil
+		}
+
+		if !errors.Is(err, syscall.EWOULDBLOCK) || time.Now().After(deadline) {
+			f.Close() //nolint:errcheck,gosec // ok
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+
+		time.Sleep(lockPollInterval)
+	}
+}
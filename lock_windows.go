@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// lockFile takes an exclusive LockFileEx lock on path, waiting up to timeout;
+// Windows releases it when the process exits, too.
+func lockFile(path string, timeout time.Duration) (unlock func(), err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, privateFileMode) //nolint:gosec // ok
+	if err != nil {
+		return nil, fmt.Errorf("lock %s: %w", path, err)
+	}
+
+	h, ol := windows.Handle(f.Fd()), new(windows.Overlapped)
+	deadline := time.Now().Add(timeout)
+
+	for {
+		err = windows.LockFileEx(h, windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, ol)
+		if err == nil {
+			return func() {
+				windows.UnlockFileEx(h, 0, 1, 0, ol) //nolint:errcheck,gosec // Released on close anyway.
+				f.Close()                            //nolint:errcheck,gosec // ok
+			}, nil
+		}
+
+		if !errors.Is(err, windows.ERROR_LOCK_VIOLATION) || time.Now().After(deadline) {
+			f.Close() //nolint:errcheck,gosec // ok
+			return nil, fmt.Errorf("lock %s: %w", path, err)
+		}
+
+		time.Sleep(lockPollInterval)
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// logout deletes the cached session of the named (else the current) profile
+// or, with --all, of every profile, keeping their configuration: the next
+// load starts a new session. The SSO sign in of SSO profiles goes, too.
+func (a *app) logout(w io.Writer, args []string) (err error) {
+	var all bool
+
+	flags := flag.NewFlagSet("logout", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.BoolVar(&all, "all", false, "log out of all profiles")
+
+	// The profile may come before or after the flags.
+	name := a.AWSProfile
+	if err = flags.Parse(args); err == nil && flags.NArg() > 0 {
+		name = flags.Arg(0)
+		err = flags.Parse(flags.Args()[1:])
+	}
+
+	if err != nil {
+		return fmt.Errorf("logout: %w", err)
+	}
+
+	if flags.NArg() > 0 || (all && len(args) > 1) {
+		return fmt.Errorf("logout: unexpected arguments %q, want a profile or --all", args)
+	}
+
+	names := []string{name}
+	if all {
+		if names, err = a.allSessionNames(); err != nil {
+			return fmt.Errorf("logout: %w", err)
+		}
+	}
+
+	for _, name := range names {
+		if err = a.store.Delete(sessionService, name); errors.Is(err, errNotFound) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("logout %s: %w", name, err)
+		}
+
+		if _, err = fmt.Fprintf(w, "logged out of %s\n", name); err != nil {
+			return
+		}
+	}
+
+	return a.logoutSSO(w, name, all)
+}
+
+// allSessionNames lists the sessions and, in case some are not indexed
+// (e.g. stored before the index), the profiles.
+func (a *app) allSessionNames() (names []string, err error) {
+	a.backfillIndex(a.store)
+
+	if names, err = a.store.List(sessionService); err != nil {
+		return
+	}
+
+	profiles, err := a.store.List(keyringService)
+	for _, name := range profiles {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	return
+}
+
+// logoutSSO deletes the SSO token of the profile or, if all, every SSO
+// token, so the next refresh signs in again. Tokens are per start URL, so
+// this logs out of the other profiles using it, too.
+func (a *app) logoutSSO(w io.Writer, name string, all bool) (err error) {
+	var urls []string
+
+	if all {
+		urls, err = a.store.List(ssoService)
+	} else {
+		urls, err = a.ssoStartURLs(name)
+	}
+
+	if err != nil {
+		return fmt.Errorf("logout: %w", err)
+	}
+
+	for _, url := range urls {
+		if err = a.store.Delete(ssoService, url); errors.Is(err, errNotFound) {
+			continue
+		} else if err != nil {
+			return fmt.Errorf("logout %s: %w", url, err)
+		}
+
+		if _, err = fmt.Fprintf(w, "logged out of %s\n", url); err != nil {
+			return
+		}
+	}
+
+	return nil
+}
+
+// ssoStartURLs is the start URL of the profile, if it exists and is an SSO
+// one.
+func (a *app) ssoStartURLs(name string) (_ []string, err error) {
+	var c Creds
+
+	if err = c.load(a.store, name); errors.Is(err, errNotFound) || (err == nil && !c.isSSO()) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("profile %q: %w", name, err)
+	}
+
+	return []string{c.SsoStartURL}, nil
+}
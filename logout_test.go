@@ -0,0 +1,100 @@
+//nolint:lll // ok
+package main
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestAppLogout(t *testing.T) {
+	tests := []struct {
+		name      string
+		want      string
+		args      []string
+		wantLeft  []string
+		wantError bool
+	}{
+		{name: "current", want: "logged out of dev\n", wantLeft: []string{"ci", "prod"}},
+		{name: "named", args: []string{"prod"}, want: "logged out of prod\n", wantLeft: []string{"ci", "dev"}},
+		{name: "no session", args: []string{"nope"}, wantLeft: []string{"ci", "dev", "prod"}},
+		{name: "all", args: []string{"--all"}, want: "logged out of ci\nlogged out of dev\nlogged out of prod\n"},
+		{name: "profile and all", args: []string{"prod", "--all"}, wantError: true, wantLeft: []string{"ci", "dev", "prod"}},
+		{name: "unknown flag", args: []string{"--everything"}, wantError: true, wantLeft: []string{"ci", "dev", "prod"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+
+			st := keyringStore{}
+			for _, name := range []string{"dev", "prod", "ci"} {
+				st.Set(keyringService, name, `{"Version":1,"RoleArn":"arn:role","SourceProfile":"base"}`) //nolint:errcheck,gosec // ok
+				st.Set(sessionService, name, `{"Version":1,"AccessKeyId":"ASIA"}`)                        //nolint:errcheck,gosec // ok
+			}
+
+			ap := app{store: st, config: config{AWSProfile: "dev"}}
+
+			var buf bytes.Buffer
+
+			if err := ap.logout(&buf, tt.args); (err != nil) != tt.wantError {
+				t.Fatalf("logout() error = %v, wantError %v", err, tt.wantError)
+			}
+
+			if got := buf.String(); got != tt.want {
+				t.Errorf("logout() = %q, want %q", got, tt.want)
+			}
+
+			for _, name := range []string{"dev", "prod", "ci"} {
+				if _, err := st.Get(keyringService, name); err != nil {
+					t.Errorf("profile %s deleted: %v", name, err)
+				}
+			}
+
+			if got, _ := st.List(sessionService); !slices.Equal(got, tt.wantLeft) { //nolint:errcheck // ok
+				t.Errorf("sessions left = %v, want %v", got, tt.wantLeft)
+			}
+		})
+	}
+}
+
+func TestAppLogoutSSO(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		want string
+		args []string
+	}{
+		{name: "profile", args: []string{"sso"}, want: "logged out of sso\nlogged out of " + testStartURL + "\n"},
+		{name: "all", args: []string{"--all"}, want: "logged out of sso\nlogged out of " + testStartURL + "\n"},
+		{name: "other profile", args: []string{"static"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+
+			st := keyringStore{}
+			st.Set(keyringService, "sso", `{"Version":2,"SsoStartUrl":"`+testStartURL+`","SsoRoleName":"Admin"}`) //nolint:errcheck,gosec // ok
+			st.Set(keyringService, "static", `{"Version":2,"AccessKeyId":"AKIA","SecretAccessKey":"s"}`)          //nolint:errcheck,gosec // ok
+			st.Set(sessionService, "sso", `{"Version":2,"AccessKeyId":"ASIA"}`)                                   //nolint:errcheck,gosec // ok
+			st.Set(ssoService, testStartURL, `{"AccessToken":"token"}`)                                           //nolint:errcheck,gosec // ok
+
+			ap := app{store: st}
+
+			var buf bytes.Buffer
+
+			if err := ap.logout(&buf, tt.args); err != nil {
+				t.Fatalf("logout() error = %v", err)
+			}
+
+			if got := buf.String(); got != tt.want {
+				t.Errorf("logout() = %q, want %q", got, tt.want)
+			}
+
+			if _, err := st.Get(ssoService, testStartURL); errors.Is(err, errNotFound) != (tt.want != "") {
+				t.Errorf("SSO token error = %v, want deleted %v", err, tt.want != "")
+			}
+		})
+	}
+}
@@ -7,32 +7,64 @@ import (
 	"cmp"
 	"context"
 	_ "embed"
+	"encoding/json/jsontext"
 	"encoding/json/v2"
 	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"os"
+	"os/user"
+	"regexp"
 	"runtime/debug"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	acfg "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/iam"
+	"github.com/aws/aws-sdk-go-v2/service/sso"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
 	"github.com/aws/aws-sdk-go-v2/service/sts"
-	"github.com/zalando/go-keyring"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"golang.org/x/term"
 
 	"github.com/alexaandru/confetti"
 )
 
 type Creds struct { //nolint:govet // ok//nolint:govet // ok
-	Version int `json:"Version"` // Always 1.
+	Version int `json:"Version"` // The credsVersion it was stored with.
 
 	AccessKeyID     string    `json:"AccessKeyId,omitempty"`
 	SecretAccessKey string    `json:"SecretAccessKey,omitempty"`
 	SessionToken    string    `json:"SessionToken,omitempty"`
 	Expiration      time.Time `json:"Expiration,omitzero"`
 
-	RoleArn       string `json:"RoleArn,omitempty"`
-	SourceProfile string `json:"SourceProfile,omitempty"`
+	RoleArn         string `json:"RoleArn,omitempty"`
+	SourceProfile   string `json:"SourceProfile,omitempty"`
+	RoleSessionName string `json:"RoleSessionName,omitempty"`
+
+	WebIdentityTokenFile    string `json:"WebIdentityTokenFile,omitempty"`
+	WebIdentityTokenKeyring string `json:"WebIdentityTokenKeyring,omitempty"` // As service/username.
+	WebIdentityTokenCommand string `json:"WebIdentityTokenCommand,omitempty"`
+
+	SsoStartURL  string `json:"SsoStartUrl,omitempty"`
+	SsoRegion    string `json:"SsoRegion,omitempty"`
+	SsoAccountID string `json:"SsoAccountId,omitempty"`
+	SsoRoleName  string `json:"SsoRoleName,omitempty"`
+
+	MfaSerial string `json:"MfaSerial,omitempty"`
+	MfaTotp   string `json:"MfaTotp,omitempty"`
+
+	ExternalID        string            `json:"ExternalId,omitempty"`
+	SourceIdentity    string            `json:"SourceIdentity,omitempty"`
+	Tags              map[string]string `json:"Tags,omitempty"`
+	TransitiveTagKeys []string          `json:"TransitiveTagKeys,omitempty"`
+	Policy            string            `json:"Policy,omitempty"`
+	PolicyArns        []string          `json:"PolicyArns,omitempty"`
+
+	UseSessionToken bool `json:"UseSessionToken,omitzero"`
 
 	SessionTTL time.Duration `json:"SessionTTL,omitzero,format:units"` //nolint:tagliatelle // ok
 	SkewPad    time.Duration `json:"SkewPad,omitzero,format:units"`
@@ -42,13 +74,22 @@ type app struct { //nolint:govet // ok
 	config
 	iamAPI
 
-	prompt      func(label string, val *string) error
-	mkSTSClient func(aws.CredentialsProvider) stsAPI
+	prompt          func(label string, val *string) error
+	ttyPrompt       func(label string, val *string) error
+	ttySecret       func(label string, val *string) error
+	store           Store
+	mkSTSClient     func(aws.CredentialsProvider) stsAPI
+	mkSSOOIDCClient func(region string) ssoOIDCAPI
+	mkSSOClient     func(region string) ssoAPI
+	lockDir         string // For the refresh locks, none if empty.
 }
 
-//nolint:inamedparam // ok
+//nolint:inamedparam,lll // ok
 type stsAPI interface {
 	AssumeRole(context.Context, *sts.AssumeRoleInput, ...func(*sts.Options)) (*sts.AssumeRoleOutput, error)
+	GetSessionToken(context.Context, *sts.GetSessionTokenInput, ...func(*sts.Options)) (*sts.GetSessionTokenOutput, error)
+	AssumeRoleWithWebIdentity(context.Context, *sts.AssumeRoleWithWebIdentityInput, ...func(*sts.Options)) (*sts.AssumeRoleWithWebIdentityOutput, error)
+	GetCallerIdentity(context.Context, *sts.GetCallerIdentityInput, ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
 }
 
 //nolint:inamedparam // ok
@@ -59,22 +100,51 @@ type iamAPI interface {
 
 type config struct {
 	AWSRegion,
-	AWSProfile string
+	AWSProfile,
+	AwbusRoleSessionName,
+	AwbusBackend,
+	AwbusFile,
+	AwbusPassphrase,
+	AwbusPassphraseCommand,
+	AwbusKeepassFile,
+	AwbusKeepassKeyfile,
+	AwbusVaultMount,
+	AwbusVaultPath,
+	AwbusVaultRoleID,
+	AwbusVaultSecretID,
+	AwbusAgentSocket,
+	VaultAddr,
+	VaultToken,
+	VaultNamespace,
+	PasswordStoreDir,
+	AWSConfigFile,
+	AWSSharedCredentialsFile string
 
 	SkewPad,
-	SessionTTL time.Duration
+	SessionTTL,
+	AwbusRefreshTimeout,
+	AwbusAgentTTL,
+	AwbusAgentTimeout time.Duration
 }
 
 const (
 	keyringService       = "awbus"
+	sessionService       = keyringService + "-session"
 	defaultRegion        = "us-east-1"
 	defaultSkewPad       = 2 * time.Minute
 	defaultSessionTTL    = time.Hour
 	minAllowedSessionTTL = 15 * time.Minute
 	maxAllowedSessionTTL = 12 * time.Hour
 	defaultProfileName   = "default"
+	defaultSessionName   = keyringService + "-{source}"
+	maxChainDepth        = 5
+	maxChainedSessionTTL = time.Hour // AWS limit for role chaining.
+	maxSessionNameLen    = 64        // STS limit, expanded names are truncated to it.
 )
 
+// roleSessionNameRe is the STS RoleSessionName constraint.
+var roleSessionNameRe = regexp.MustCompile(`^[\w+=,.@-]{2,64}$`)
+
 //go:embed help.txt
 var help string
 
@@ -86,14 +156,27 @@ func newApp(iamClient iamAPI) (a app, err error) {
 	}
 
 	a.iamAPI = iamClient
-	a.prompt = prompt
+	a.prompt, a.ttyPrompt, a.ttySecret = prompt, ttyPrompt, ttySecret
+	a.lockDir = refreshLockDir()
+
+	if a.store, err = a.newStore(a.AwbusBackend); err != nil {
+		return
+	}
+
 	a.SessionTTL = cmp.Or(a.SessionTTL, defaultSessionTTL)
 	a.SkewPad = cmp.Or(a.SkewPad, defaultSkewPad)
 	a.AWSProfile = cmp.Or(a.AWSProfile, defaultProfileName)
 	a.AWSRegion = cmp.Or(a.AWSRegion, defaultRegion)
+	a.AwbusRoleSessionName = cmp.Or(a.AwbusRoleSessionName, defaultSessionName)
 	a.mkSTSClient = func(creds aws.CredentialsProvider) stsAPI {
 		return sts.New(sts.Options{Credentials: creds, Region: a.AWSRegion})
 	}
+	a.mkSSOOIDCClient = func(region string) ssoOIDCAPI {
+		return ssooidc.New(ssooidc.Options{Region: region})
+	}
+	a.mkSSOClient = func(region string) ssoAPI {
+		return sso.New(sso.Options{Region: region})
+	}
 
 	return
 }
@@ -113,43 +196,93 @@ func (a *app) ensureIAMClient(ctx context.Context) (err error) {
 	return
 }
 
-func krGet(profile string) (string, error) {
-	return keyring.Get(keyringService, profile)
-}
+// load loads the configuration of the profile name, upgrading it in place
+// when stored by an older version.
+func (c *Creds) load(st Store, name string) (err error) {
+	raw, err := st.Get(keyringService, name)
+	if err != nil {
+		return err
+	}
 
-func krSet(profile, value string) error {
-	return keyring.Set(keyringService, profile, value)
+	upgraded, err := upgradeCreds(st, name, raw)
+	if err != nil {
+		return
+	}
+
+	if err = c.decode(name, upgraded); err != nil || upgraded == raw {
+		return
+	}
+
+	return c.store(st, name)
 }
 
-func krDel(profile string) error {
-	return keyring.Delete(keyringService, profile)
+// useSession sets the cached session of the profile name, if any, as the
+// credentials of c. A missing or unreadable one just needs refreshing.
+func (c *Creds) useSession(st Store, name string) {
+	var session Creds
+
+	if session.loadSession(st, name) == nil {
+		c.AccessKeyID, c.SecretAccessKey = session.AccessKeyID, session.SecretAccessKey
+		c.SessionToken, c.Expiration = session.SessionToken, session.Expiration
+	}
 }
 
-func (c *Creds) load(name string) (err error) {
-	raw, err := krGet(name)
+func (c *Creds) loadSession(st Store, name string) (err error) {
+	raw, err := st.Get(sessionService, name)
 	if err != nil {
 		return err
 	}
 
-	if raw == "" {
-		return fmt.Errorf("profile %q empty JSON", name)
+	return c.decode(name, raw)
+}
+
+// decode decodes a stored Creds JSON, refusing the ones written by newer
+// versions, whose fields it might drop.
+func (c *Creds) decode(name, raw string) (err error) {
+	version, err := storedVersion(raw)
+	if err != nil {
+		return fmt.Errorf("profile %q: %w", name, err)
+	}
+
+	if version > credsVersion {
+		return fmt.Errorf("profile %q: stored by a newer awbus (version %d, this one reads up to %d)",
+			name, version, credsVersion)
+	}
+
+	if err = json.Unmarshal([]byte(raw), c, json.RejectUnknownMembers(true)); err != nil {
+		return fmt.Errorf("profile %q: %w", name, err)
 	}
 
-	return json.Unmarshal([]byte(raw), c)
+	return
 }
 
-func (c *Creds) store(name string) (err error) {
-	c.Version = 1
+func (c *Creds) store(st Store, name string) (err error) {
+	raw, err := c.encode()
+	if err != nil {
+		return err
+	}
 
-	b, err := json.Marshal(*c)
+	return st.Set(keyringService, name, raw)
+}
+
+func (c *Creds) storeSession(st Store, name string) (err error) {
+	raw, err := c.encode()
 	if err != nil {
 		return err
 	}
 
-	return krSet(name, string(b))
+	return st.Set(sessionService, name, raw)
+}
+
+func (c *Creds) encode() (string, error) {
+	c.Version = credsVersion
+
+	b, err := json.Marshal(*c)
+
+	return string(b), err
 }
 
-func (c *Creds) applyDefaults(cfg config) {
+func (c *Creds) applyDefaults(cfg *config) {
 	c.SkewPad = cmp.Or(c.SkewPad, cfg.SkewPad)
 	c.SessionTTL = min(
 		max(cmp.Or(c.SessionTTL, cfg.SessionTTL), minAllowedSessionTTL),
@@ -157,11 +290,17 @@ func (c *Creds) applyDefaults(cfg config) {
 }
 
 func (c *Creds) isStatic() bool {
-	return c.RoleArn == ""
+	return c.RoleArn == "" && !c.isSSO()
+}
+
+// cachesSession tells whether the credentials of the profile are sessions,
+// kept in the session cache apart from its configuration.
+func (c *Creds) cachesSession() bool {
+	return !c.isStatic() || c.UseSessionToken
 }
 
 func (c *Creds) validateStatic() (err error) {
-	if c.RoleArn != "" {
+	if !c.isStatic() {
 		return errors.New("static validation called on non-static profile")
 	}
 
@@ -181,23 +320,19 @@ func (c *Creds) credsFresh(now time.Time) bool {
 		return true
 	}
 
+	return c.sessionFresh(now, c.SkewPad)
+}
+
+func (c *Creds) sessionFresh(now time.Time, skewPad time.Duration) bool {
 	if c.Expiration.IsZero() {
 		return false
 	}
 
-	return now.Add(c.SkewPad).Before(c.Expiration)
+	return now.Add(skewPad).Before(c.Expiration)
 }
 
 func (c *Creds) emitProfile() (err error) {
-	ep := *c
-
-	ep.Version = 1
-	ep.RoleArn = ""
-	ep.SourceProfile = ""
-	ep.SessionTTL = 0
-	ep.SkewPad = 0
-
-	b, err := json.Marshal(ep)
+	b, err := json.Marshal(c.credentials())
 	if err != nil {
 		return err
 	}
@@ -207,95 +342,322 @@ func (c *Creds) emitProfile() (err error) {
 	return err
 }
 
-func (a *app) assumeRole(ctx context.Context, base, target Creds) (Creds, error) {
-	static := aws.CredentialsProviderFunc(func(ctx context.Context) (aws.Credentials, error) {
-		return aws.Credentials{
-			AccessKeyID:     base.AccessKeyID,
-			SecretAccessKey: base.SecretAccessKey,
-			SessionToken:    base.SessionToken,
-			Source:          keyringService,
-		}, nil
-	})
-	svc := a.mkSTSClient(static)
-	input := &sts.AssumeRoleInput{
-		RoleArn:         &target.RoleArn,
-		RoleSessionName: p(keyringService + "-" + target.SourceProfile),
-		DurationSeconds: p(int32(target.SessionTTL.Seconds())),
+// credentials are the credentials of c, without its profile configuration.
+func (c *Creds) credentials() Creds {
+	return Creds{
+		Version:         1,
+		AccessKeyID:     c.AccessKeyID,
+		SecretAccessKey: c.SecretAccessKey,
+		SessionToken:    c.SessionToken,
+		Expiration:      c.Expiration,
+	}
+}
+
+func (a *app) assumeRole(ctx context.Context, name string, base, target *Creds) (c Creds, err error) {
+	c = *target
+	svc := a.mkSTSClient(base.provider())
+
+	sessionName, err := a.roleSessionName(name, &c)
+	if err != nil {
+		return c, fmt.Errorf("assume-role %s: %w", c.RoleArn, err)
+	}
+
+	input := c.assumeRoleInput(sessionName)
+
+	if c.MfaSerial != "" {
+		var code string
+
+		if code, err = a.mfaCode(&c); err != nil {
+			return c, fmt.Errorf("assume-role %s: %w", c.RoleArn, err)
+		}
+
+		input.SerialNumber = &c.MfaSerial
+		input.TokenCode = &code
 	}
 
 	out, err := svc.AssumeRole(ctx, input)
 	if err != nil {
-		return target, fmt.Errorf("assume-role %s: %w", target.RoleArn, err)
+		return c, fmt.Errorf("assume-role %s: %w", c.RoleArn, err)
 	}
 
 	if out.Credentials == nil {
-		return target, errors.New("assume-role: empty credentials")
+		return c, errors.New("assume-role: empty credentials")
 	}
 
-	target.AccessKeyID = aws.ToString(out.Credentials.AccessKeyId)
-	target.SecretAccessKey = aws.ToString(out.Credentials.SecretAccessKey)
-	target.SessionToken = aws.ToString(out.Credentials.SessionToken)
+	c.setSession(out.Credentials)
+
+	return c, nil
+}
+
+// roleSessionName expands the profile's (or else the global) RoleSessionName
+// template placeholders: {user}, {host}, {profile}, {source} and {date}.
+func (a *app) roleSessionName(name string, c *Creds) (string, error) {
+	var username, hostname string
 
-	if out.Credentials.Expiration != nil {
-		target.Expiration = *out.Credentials.Expiration
-	} else {
-		target.Expiration = time.Time{}
+	if u, err := user.Current(); err == nil {
+		username = u.Username
 	}
 
-	return target, nil
+	hostname, _ = os.Hostname() //nolint:errcheck // Placeholder is left empty.
+
+	sessionName := strings.NewReplacer(
+		"{user}", sanitizeSessionName(username),
+		"{host}", sanitizeSessionName(hostname),
+		"{profile}", sanitizeSessionName(name),
+		"{source}", sanitizeSessionName(c.SourceProfile),
+		"{date}", time.Now().UTC().Format("20060102"),
+	).Replace(cmp.Or(c.RoleSessionName, a.AwbusRoleSessionName, defaultSessionName))
+	sessionName = sessionName[:min(len(sessionName), maxSessionNameLen)]
+
+	if !roleSessionNameRe.MatchString(sessionName) {
+		return "", fmt.Errorf("invalid RoleSessionName %q: must be 2-64 characters of [\\w+=,.@-]", sessionName)
+	}
+
+	return sessionName, nil
+}
+
+// checkSessionNameTemplate rejects the RoleSessionName templates that can only
+// expand to an invalid name, e.g. with an unknown placeholder, when stored.
+func checkSessionNameTemplate(tmpl string) error {
+	if tmpl == "" {
+		return nil
+	}
+
+	sample := strings.NewReplacer(
+		"{user}", "--", "{host}", "--", "{profile}", "--", "{source}", "--", "{date}", "--",
+	).Replace(tmpl)
+
+	if !roleSessionNameRe.MatchString(sample[:min(len(sample), maxSessionNameLen)]) {
+		return fmt.Errorf("invalid RoleSessionName template %q: must expand to 2-64 characters of [\\w+=,.@-]", tmpl)
+	}
+
+	return nil
+}
+
+func sanitizeSessionName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', strings.ContainsRune("_+=,.@-", r):
+			return r
+		default:
+			return '-'
+		}
+	}, s)
+}
+
+func (c *Creds) assumeRoleInput(sessionName string) *sts.AssumeRoleInput {
+	input := &sts.AssumeRoleInput{
+		RoleArn:           &c.RoleArn,
+		RoleSessionName:   &sessionName,
+		DurationSeconds:   p(int32(c.SessionTTL.Seconds())),
+		ExternalId:        pNonZero(c.ExternalID),
+		SourceIdentity:    pNonZero(c.SourceIdentity),
+		Policy:            pNonZero(c.Policy),
+		TransitiveTagKeys: c.TransitiveTagKeys,
+		PolicyArns:        c.policyArns(),
+	}
+
+	for _, k := range slices.Sorted(maps.Keys(c.Tags)) {
+		input.Tags = append(input.Tags, types.Tag{Key: p(k), Value: p(c.Tags[k])})
+	}
+
+	return input
+}
+
+func (c *Creds) policyArns() (arns []types.PolicyDescriptorType) {
+	for _, arn := range c.PolicyArns {
+		arns = append(arns, types.PolicyDescriptorType{Arn: p(arn)})
+	}
+
+	return
+}
+
+// sessionToken returns a GetSessionToken session for the static profile
+// base, reusing the one cached under sessionService while still fresh.
+func (a *app) sessionToken(ctx context.Context, name string, base *Creds) (c Creds, err error) {
+	if c.loadSession(a.store, name) == nil && c.sessionFresh(time.Now(), base.SkewPad) {
+		return
+	}
+
+	unlock, err := a.lockRefresh(name)
+	if err != nil {
+		return Creds{}, err
+	}
+	defer unlock()
+
+	if c = (Creds{}); c.loadSession(a.store, name) == nil && c.sessionFresh(time.Now(), base.SkewPad) {
+		return
+	}
+
+	input := &sts.GetSessionTokenInput{DurationSeconds: p(int32(base.SessionTTL.Seconds()))}
+
+	if base.MfaSerial != "" {
+		var code string
+
+		if code, err = a.mfaCode(base); err != nil {
+			return Creds{}, fmt.Errorf("get-session-token %s: %w", name, err)
+		}
+
+		input.SerialNumber = &base.MfaSerial
+		input.TokenCode = &code
+	}
+
+	out, err := a.mkSTSClient(base.provider()).GetSessionToken(ctx, input)
+	if err != nil {
+		return Creds{}, fmt.Errorf("get-session-token %s: %w", name, err)
+	}
+
+	if out.Credentials == nil {
+		return Creds{}, errors.New("get-session-token: empty credentials")
+	}
+
+	c = Creds{}
+	c.setSession(out.Credentials)
+
+	if err = c.storeSession(a.store, name); err != nil {
+		return Creds{}, fmt.Errorf("persist session for profile %q: %w", name, err)
+	}
+
+	return
+}
+
+func (c *Creds) provider() aws.CredentialsProviderFunc {
+	return aws.CredentialsProviderFunc(func(context.Context) (aws.Credentials, error) {
+		return aws.Credentials{
+			AccessKeyID:     c.AccessKeyID,
+			SecretAccessKey: c.SecretAccessKey,
+			SessionToken:    c.SessionToken,
+			Source:          keyringService,
+		}, nil
+	})
+}
+
+func (c *Creds) setSession(cr *types.Credentials) {
+	c.AccessKeyID = aws.ToString(cr.AccessKeyId)
+	c.SecretAccessKey = aws.ToString(cr.SecretAccessKey)
+	c.SessionToken = aws.ToString(cr.SessionToken)
+	c.Expiration = aws.ToTime(cr.Expiration)
+}
+
+func (a *app) mfaCode(c *Creds) (code string, err error) {
+	if c.MfaTotp == "" {
+		err = a.ttyPrompt("MFA code for "+c.MfaSerial, &code)
+		return
+	}
+
+	seed, err := a.store.Get(totpService, c.MfaTotp)
+	if err != nil {
+		return "", fmt.Errorf("load TOTP seed %q: %w", c.MfaTotp, err)
+	}
+
+	return totpCode(seed, time.Now())
 }
 
 func (a *app) resolveAndMaybeRefresh(ctx context.Context, name string) (c Creds, err error) {
-	if err = c.load(name); err != nil {
+	return a.resolveChain(ctx, name, nil)
+}
+
+// resolveChain resolves name, recursively resolving (and refreshing, when
+// stale) its SourceProfile chain; chain holds the profiles visited so far.
+func (a *app) resolveChain(ctx context.Context, name string, chain []string) (c Creds, err error) {
+	if slices.Contains(chain, name) {
+		return Creds{}, fmt.Errorf("profile %q: source profile cycle (%s -> %s)",
+			name, strings.Join(chain, " -> "), name)
+	}
+
+	if len(chain) >= maxChainDepth {
+		return Creds{}, fmt.Errorf("profile %q: role chain exceeds %d hops", name, maxChainDepth)
+	}
+
+	if err = c.load(a.store, name); err != nil {
 		return
 	}
 
-	c.applyDefaults(a.config)
+	c.applyDefaults(&a.config)
 
 	if c.isStatic() {
 		if err = c.validateStatic(); err != nil {
 			return Creds{}, fmt.Errorf("profile %q invalid static: %w", name, err)
 		}
 
+		if c.UseSessionToken {
+			return a.sessionToken(ctx, name, &c)
+		}
+
 		return
 	}
 
-	if c.SourceProfile == "" {
-		return Creds{}, fmt.Errorf("profile %q missing SourceProfile for RoleArn", name)
+	if !c.isSSO() && c.SourceProfile == "" && !c.isWebIdentity() {
+		return Creds{}, fmt.Errorf("profile %q missing SourceProfile or web identity token for RoleArn", name)
 	}
 
-	base := Creds{}
-	if err = base.load(c.SourceProfile); err != nil {
-		return Creds{}, fmt.Errorf("load source profile %q: %w", c.SourceProfile, err)
+	c.useSession(a.store, name)
+
+	if c.credsFresh(time.Now()) {
+		return
 	}
 
-	base.applyDefaults(a.config)
+	return a.refreshRole(ctx, name, chain)
+}
 
-	if !base.isStatic() {
-		return Creds{}, fmt.Errorf("source profile %q is not static (multi-hop not allowed)", c.SourceProfile)
+// refreshRole refreshes the role session of name under its refresh lock,
+// unless another process refreshed it while we waited for the lock.
+func (a *app) refreshRole(ctx context.Context, name string, chain []string) (c Creds, err error) {
+	unlock, err := a.lockRefresh(name)
+	if err != nil {
+		return
 	}
+	defer unlock()
 
-	if err = base.validateStatic(); err != nil {
-		return Creds{}, fmt.Errorf("source profile %q invalid static: %w", c.SourceProfile, err)
+	if err = c.load(a.store, name); err != nil {
+		return
 	}
 
-	now := time.Now()
-	if c.credsFresh(now) {
+	c.applyDefaults(&a.config)
+
+	c.useSession(a.store, name)
+
+	if c.credsFresh(time.Now()) {
 		return
 	}
 
-	refreshed, err := a.assumeRole(ctx, base, c)
+	var refreshed Creds
+
+	switch {
+	case c.isSSO():
+		refreshed, err = a.ssoRoleCredentials(ctx, &c)
+	case c.isWebIdentity():
+		refreshed, err = a.assumeRoleWithWebIdentity(ctx, name, &c)
+	default:
+		refreshed, err = a.assumeRoleFromSource(ctx, name, chain, &c)
+	}
+
 	if err != nil {
-		return
+		return Creds{}, err
 	}
 
-	if err = refreshed.store(name); err != nil {
-		return Creds{}, fmt.Errorf("persist refreshed profile %q: %w", name, err)
+	session := refreshed.credentials()
+
+	if err = session.storeSession(a.store, name); err != nil {
+		return Creds{}, fmt.Errorf("persist session for profile %q: %w", name, err)
 	}
 
 	return refreshed, nil
 }
 
+func (a *app) assumeRoleFromSource(ctx context.Context, name string, chain []string, c *Creds) (Creds, error) {
+	base, err := a.resolveChain(ctx, c.SourceProfile, append(chain, name))
+	if err != nil {
+		return Creds{}, fmt.Errorf("source profile %q: %w", c.SourceProfile, err)
+	}
+
+	if !base.isStatic() {
+		c.SessionTTL = min(c.SessionTTL, maxChainedSessionTTL)
+	}
+
+	return a.assumeRole(ctx, name, &base, c)
+}
+
 func (a *app) rotateCredentials(ctx context.Context, profileName string) (err error) {
 	if err = a.ensureIAMClient(ctx); err != nil {
 		return fmt.Errorf("initialize IAM client: %w", err)
@@ -303,7 +665,7 @@ func (a *app) rotateCredentials(ctx context.Context, profileName string) (err er
 
 	var c Creds
 
-	if err = c.load(profileName); err != nil {
+	if err = c.load(a.store, profileName); err != nil {
 		return fmt.Errorf("load profile %q: %w", profileName, err)
 	}
 
@@ -329,7 +691,7 @@ func (a *app) rotateCredentials(ctx context.Context, profileName string) (err er
 	c.AccessKeyID = *newAccessKey.AccessKeyId
 	c.SecretAccessKey = *newAccessKey.SecretAccessKey
 
-	if err = c.store(profileName); err != nil {
+	if err = c.store(a.store, profileName); err != nil {
 		return fmt.Errorf("store new credentials: %w", err)
 	}
 
@@ -338,7 +700,17 @@ func (a *app) rotateCredentials(ctx context.Context, profileName string) (err er
 	return err
 }
 
-//nolint:gocognit,cyclop,funlen,nakedret // ok
+// load emits the credentials of the current profile, for credential_process.
+func (a *app) load(ctx context.Context) (err error) {
+	c, err := a.loadCreds(ctx, a.AWSProfile)
+	if err != nil {
+		return
+	}
+
+	return c.emitProfile()
+}
+
+//nolint:cyclop,funlen,nakedret // ok
 func (a *app) run(ctx context.Context, args []string) (err error) {
 	cmd := "load"
 	if len(args) > 1 {
@@ -347,50 +719,15 @@ func (a *app) run(ctx context.Context, args []string) (err error) {
 
 	switch cmd {
 	case "load":
-		var c Creds
-
-		c, err = a.resolveAndMaybeRefresh(ctx, a.AWSProfile)
-		if err != nil {
-			break
-		}
-
-		err = c.emitProfile()
+		err = a.load(ctx)
 	case "rotate":
 		err = a.rotateCredentials(ctx, a.AWSProfile)
-	case "store", "store-assume":
-		var (
-			c       Creds
-			profile string
-		)
-
-		if err = a.prompt("Profile Name (press Enter for '"+a.AWSProfile+"')", &profile); err != nil {
-			profile = a.AWSProfile
-		}
-
-		if cmd == "store-assume" { //nolint:nestif // ok
-			if err = a.prompt("RoleArn", &c.RoleArn); err != nil {
-				break
-			}
-
-			if err = a.prompt("SourceProfile", &c.SourceProfile); err != nil {
-				break
-			}
-		} else {
-			if err = a.prompt("AccessKeyId", &c.AccessKeyID); err != nil {
-				break
-			}
-
-			if err = a.prompt("SecretAccessKey", &c.SecretAccessKey); err != nil {
-				break
-			}
-		}
-
-		err = c.store(profile)
+	case "store", "store-assume", "store-web-identity", "store-sso":
+		err = a.storeProfile(ctx, cmd, args[2:])
 	case "delete":
-		if err = a.prompt("Deleting profile (press Enter to delete '"+a.AWSProfile+"', "+
-			"press anything else to abort)", &a.AWSProfile); err != nil {
-			err = krDel(a.AWSProfile)
-		}
+		err = a.deleteProfile()
+	case "logout":
+		err = a.logout(os.Stdout, args[2:])
 	case "version":
 		fmt.Println(keyringService, version)
 	case "get":
@@ -401,7 +738,7 @@ func (a *app) run(ctx context.Context, args []string) (err error) {
 
 		var out string
 
-		out, err = keyring.Get(args[2], args[3])
+		out, err = a.store.Get(args[2], args[3])
 		if err != nil {
 			break
 		}
@@ -418,16 +755,7 @@ func (a *app) run(ctx context.Context, args []string) (err error) {
 			username = args[3]
 		}
 
-		var (
-			stat  os.FileInfo
-			input []byte
-		)
-
-		if stat, err = os.Stdin.Stat(); err == nil && (stat.Mode()&os.ModeCharDevice) == 0 {
-			if input, err = os.ReadFile("/dev/stdin"); err == nil {
-				secret = string(input)
-			}
-		}
+		secret = stdinSecret()
 
 		if err = a.promptIfEmpty("Service", &service); err != nil {
 			break
@@ -441,7 +769,29 @@ func (a *app) run(ctx context.Context, args []string) (err error) {
 			break
 		}
 
-		err = keyring.Set(service, username, secret)
+		err = a.store.Set(service, username, secret)
+	case "agent":
+		err = a.agent(ctx, os.Stdout, args[2:])
+	case "serve-ecs":
+		err = a.serveECS(ctx, os.Stdout, args[2:])
+	case "serve-imds":
+		err = a.serveIMDS(ctx, os.Stdout, args[2:])
+	case "exec":
+		err = a.execCommand(ctx, args[2:])
+	case "env":
+		err = a.env(ctx, os.Stdout, args[2:])
+	case "whoami":
+		err = a.whoami(ctx, os.Stdout, args[2:])
+	case "show":
+		err = a.show(os.Stdout, args[2:], time.Now())
+	case "list":
+		err = a.list(os.Stdout, args[2:], time.Now())
+	case "migrate":
+		err = a.migrate(os.Stdout, args[2:])
+	case "put-totp":
+		err = a.putTOTP(args)
+	case "totp":
+		err = a.printTOTP(args)
 	case "help":
 		fmt.Println(help)
 	default:
@@ -451,16 +801,248 @@ func (a *app) run(ctx context.Context, args []string) (err error) {
 	return
 }
 
+// deleteProfile deletes the current profile, and its cached session, once
+// confirmed.
+func (a *app) deleteProfile() (err error) {
+	if err = a.prompt("Deleting profile (press Enter to delete '"+a.AWSProfile+"', "+
+		"press anything else to abort)", &a.AWSProfile); err != nil {
+		if err = a.store.Delete(keyringService, a.AWSProfile); err == nil {
+			a.store.Delete(sessionService, a.AWSProfile) //nolint:errcheck,gosec // Best effort, there may be none.
+		}
+	}
+
+	return
+}
+
+// storeProfile prompts for and stores a profile of the cmd kind and, with
+// --verify, checks that it works by resolving it and calling
+// sts:GetCallerIdentity.
+func (a *app) storeProfile(ctx context.Context, cmd string, args []string) (err error) {
+	var (
+		c       Creds
+		profile string
+	)
+
+	if err = a.prompt("Profile Name (press Enter for '"+a.AWSProfile+"')", &profile); err != nil {
+		profile = a.AWSProfile
+	}
+
+	switch cmd {
+	case "store-assume":
+		err = a.promptRole(&c)
+	case "store-web-identity":
+		err = a.promptWebIdentity(&c)
+	case "store-sso":
+		err = a.promptSSO(&c)
+	default:
+		err = a.promptStatic(&c)
+	}
+
+	if err != nil {
+		return
+	}
+
+	if err = c.store(a.store, profile); err != nil {
+		return
+	}
+
+	// The session of the profile it replaces, if any, is no longer valid.
+	a.store.Delete(sessionService, profile) //nolint:errcheck,gosec // Best effort, there may be none.
+
+	if !slices.Contains(args, "--verify") {
+		return
+	}
+
+	if err = a.printCallerIdentity(ctx, os.Stdout, profile); err != nil {
+		return fmt.Errorf("profile %q stored, but verification failed: %w", profile, err)
+	}
+
+	return
+}
+
+func (a *app) promptRole(c *Creds) (err error) {
+	if err = a.prompt("RoleArn", &c.RoleArn); err != nil {
+		return
+	}
+
+	if err = a.prompt("SourceProfile", &c.SourceProfile); err != nil {
+		return
+	}
+
+	a.promptMFA(c)
+
+	var tags, transitive, policyArns string
+
+	a.promptOptional("RoleSessionName template (press Enter for default)", &c.RoleSessionName)
+
+	if err = checkSessionNameTemplate(c.RoleSessionName); err != nil {
+		return
+	}
+
+	a.promptOptional("ExternalId (press Enter to skip)", &c.ExternalID)
+	a.promptOptional("SourceIdentity (press Enter to skip)", &c.SourceIdentity)
+	a.promptOptional("Tags as key=value,... (press Enter to skip)", &tags)
+
+	if c.Tags, err = parseTags(tags); err != nil {
+		return
+	}
+
+	if len(c.Tags) > 0 {
+		a.promptOptional("TransitiveTagKeys as key,... (press Enter to skip)", &transitive)
+		c.TransitiveTagKeys = splitList(transitive)
+	}
+
+	a.promptOptional("Policy JSON (press Enter to skip)", &c.Policy)
+
+	if c.Policy != "" && !jsontext.Value(c.Policy).IsValid() {
+		return errors.New("policy is not valid JSON")
+	}
+
+	a.promptOptional("PolicyArns as arn,... (press Enter to skip)", &policyArns)
+	c.PolicyArns = splitList(policyArns)
+
+	return
+}
+
+func (a *app) promptStatic(c *Creds) (err error) {
+	if err = a.prompt("AccessKeyId", &c.AccessKeyID); err != nil {
+		return
+	}
+
+	if err = a.prompt("SecretAccessKey", &c.SecretAccessKey); err != nil {
+		return
+	}
+
+	var useSession string
+
+	a.promptOptional("Use GetSessionToken (y/N)", &useSession)
+
+	if c.UseSessionToken = strings.EqualFold(useSession, "y"); c.UseSessionToken {
+		a.promptMFA(c)
+	}
+
+	return
+}
+
+func (a *app) promptMFA(c *Creds) {
+	a.promptOptional("MfaSerial (press Enter to skip)", &c.MfaSerial)
+
+	if c.MfaSerial != "" {
+		a.promptOptional("MfaTotp seed name (press Enter to skip)", &c.MfaTotp)
+	}
+}
+
+// promptOptional treats a failed prompt (i.e. an empty answer) as no value.
+func (a *app) promptOptional(label string, val *string) {
+	if err := a.prompt(label, val); err != nil {
+		*val = ""
+	}
+}
+
 func prompt(label string, val *string) (err error) {
 	fmt.Print("Enter ", label, ": ")
 
-	if _, err = fmt.Scanln(val); err != nil {
+	if *val, err = readLine(os.Stdin); err != nil {
 		return fmt.Errorf("read %s: %w", label, err)
 	}
 
 	return
 }
 
+// readLine reads a single line, one byte at a time so nothing past it is
+// consumed. Like fmt.Scanln, an empty line is an error.
+func readLine(r io.Reader) (line string, err error) {
+	var (
+		sb  strings.Builder
+		buf [1]byte
+	)
+
+	for {
+		if _, err = r.Read(buf[:]); err != nil {
+			if !errors.Is(err, io.EOF) || sb.Len() == 0 {
+				return
+			}
+
+			break
+		}
+
+		if buf[0] == '\n' {
+			break
+		}
+
+		sb.WriteByte(buf[0])
+	}
+
+	if line = strings.TrimSpace(sb.String()); line == "" {
+		return "", errors.New("unexpected newline")
+	}
+
+	return line, nil
+}
+
+// ttyPrompt reads from the controlling terminal, as stdout is reserved
+// for the credential_process output.
+func ttyPrompt(label string, val *string) error {
+	return ttyRead(label, val, false)
+}
+
+// ttySecret is ttyPrompt for passphrases, which are not echoed.
+func ttySecret(label string, val *string) error {
+	return ttyRead(label, val, true)
+}
+
+func ttyRead(label string, val *string, secret bool) (err error) {
+	in, err := os.Open(ttyIn)
+	if err != nil {
+		return fmt.Errorf("open terminal: %w", err)
+	}
+	defer in.Close() //nolint:errcheck // ok
+
+	out, err := os.OpenFile(ttyOut, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("open terminal: %w", err)
+	}
+	defer out.Close() //nolint:errcheck // ok
+
+	if _, err = fmt.Fprint(out, "Enter ", label, ": "); err != nil {
+		return
+	}
+
+	if !secret {
+		if *val, err = readLine(in); err != nil {
+			return fmt.Errorf("read %s: %w", label, err)
+		}
+
+		return
+	}
+
+	b, err := term.ReadPassword(int(in.Fd()))
+
+	fmt.Fprintln(out) //nolint:errcheck // The Enter was not echoed either.
+
+	if err != nil {
+		return fmt.Errorf("read %s: %w", label, err)
+	}
+
+	*val = strings.TrimSpace(string(b))
+
+	return
+}
+
+// stdinSecret returns whatever was piped on stdin, if anything.
+func stdinSecret() (secret string) {
+	stat, err := os.Stdin.Stat()
+	if err != nil || (stat.Mode()&os.ModeCharDevice) != 0 {
+		return
+	}
+
+	if input, rerr := os.ReadFile("/dev/stdin"); rerr == nil {
+		secret = string(input)
+	}
+
+	return
+}
+
 func (a *app) promptIfEmpty(label string, val *string) (err error) {
 	if *val == "" {
 		return a.prompt(label, val)
@@ -473,7 +1055,47 @@ func p[T any](v T) *T {
 	return &v
 }
 
+func pNonZero[T comparable](v T) *T {
+	var zero T
+	if v == zero {
+		return nil
+	}
+
+	return &v
+}
+
+func splitList(s string) (list []string) {
+	for v := range strings.SplitSeq(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+
+	return
+}
+
+func parseTags(s string) (tags map[string]string, err error) {
+	for _, kv := range splitList(s) {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok || k == "" {
+			return nil, fmt.Errorf("invalid tag %q, want key=value", kv)
+		}
+
+		if tags == nil {
+			tags = map[string]string{}
+		}
+
+		tags[k] = v
+	}
+
+	return
+}
+
 func die(msg string, err error) {
+	if ee := (exitCodeError{}); errors.As(err, &ee) {
+		os.Exit(ee.code)
+	}
+
 	if err != nil {
 		fmt.Fprintf(os.Stderr, msg+": %v\n", err)
 		os.Exit(1)
@@ -5,7 +5,12 @@ import (
 	"context"
 	"encoding/json/v2"
 	"errors"
+	"fmt"
+	"maps"
 	"os"
+	"regexp"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
@@ -18,7 +23,10 @@ import (
 )
 
 type mockSTSClient struct {
-	assumeRoleFunc func(context.Context, *sts.AssumeRoleInput, ...func(*sts.Options)) (*sts.AssumeRoleOutput, error)
+	assumeRoleFunc      func(context.Context, *sts.AssumeRoleInput, ...func(*sts.Options)) (*sts.AssumeRoleOutput, error)
+	getSessionTokenFunc func(context.Context, *sts.GetSessionTokenInput, ...func(*sts.Options)) (*sts.GetSessionTokenOutput, error)
+	assumeRoleWIFunc    func(context.Context, *sts.AssumeRoleWithWebIdentityInput, ...func(*sts.Options)) (*sts.AssumeRoleWithWebIdentityOutput, error)
+	getCallerIDFunc     func(context.Context, *sts.GetCallerIdentityInput, ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error)
 }
 
 type mockIAMClient struct {
@@ -30,6 +38,18 @@ func (m *mockSTSClient) AssumeRole(ctx context.Context, input *sts.AssumeRoleInp
 	return m.assumeRoleFunc(ctx, input, opts...)
 }
 
+func (m *mockSTSClient) GetSessionToken(ctx context.Context, input *sts.GetSessionTokenInput, opts ...func(*sts.Options)) (*sts.GetSessionTokenOutput, error) {
+	return m.getSessionTokenFunc(ctx, input, opts...)
+}
+
+func (m *mockSTSClient) AssumeRoleWithWebIdentity(ctx context.Context, input *sts.AssumeRoleWithWebIdentityInput, opts ...func(*sts.Options)) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+	return m.assumeRoleWIFunc(ctx, input, opts...)
+}
+
+func (m *mockSTSClient) GetCallerIdentity(ctx context.Context, input *sts.GetCallerIdentityInput, opts ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+	return m.getCallerIDFunc(ctx, input, opts...)
+}
+
 func (m *mockIAMClient) CreateAccessKey(ctx context.Context, input *iam.CreateAccessKeyInput, opts ...func(*iam.Options)) (*iam.CreateAccessKeyOutput, error) {
 	return m.createAccessKeyFunc(ctx, input, opts...)
 }
@@ -88,6 +108,13 @@ func TestNewApp(t *testing.T) { //nolint:funlen // ok
 			wantTTL:     defaultSessionTTL,
 			wantPad:     defaultSkewPad,
 		},
+		{
+			name: "unknown backend",
+			envVars: map[string]string{
+				"AWBUS_BACKEND": "floppy",
+			},
+			wantErr: true,
+		},
 		{
 			name: "confetti load error",
 			envVars: map[string]string{
@@ -137,133 +164,6 @@ func TestNewApp(t *testing.T) { //nolint:funlen // ok
 	}
 }
 
-func TestKrGet(t *testing.T) {
-	tests := []struct {
-		name    string
-		profile string
-		setupFn func()
-		wantVal string
-		wantErr bool
-	}{
-		{
-			name:    "existing key",
-			profile: "test-profile",
-			setupFn: func() {
-				keyring.Set(keyringService, "test-profile", "test-value") //nolint:errcheck,gosec // ok
-			},
-			wantVal: "test-value",
-		},
-		{
-			name:    "nonexistent key",
-			profile: "nonexistent",
-			setupFn: func() {},
-			wantErr: true,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			keyring.MockInit()
-			tt.setupFn()
-
-			got, err := krGet(tt.profile)
-			if (err != nil) != tt.wantErr {
-				t.Fatalf("krGet() error = %v, wantErr %v", err, tt.wantErr)
-			}
-
-			if got != tt.wantVal {
-				t.Errorf("krGet() = %s, want %s", got, tt.wantVal)
-			}
-		})
-	}
-}
-
-func TestKrSet(t *testing.T) {
-	tests := []struct {
-		name    string
-		profile string
-		value   string
-		wantErr bool
-	}{
-		{
-			name:    "valid set",
-			profile: "test-profile",
-			value:   "test-value",
-		},
-		{
-			name:    "empty value",
-			profile: "empty-profile",
-			value:   "",
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			keyring.MockInit()
-
-			err := krSet(tt.profile, tt.value)
-			if (err != nil) != tt.wantErr {
-				t.Fatalf("krSet() error = %v, wantErr %v", err, tt.wantErr)
-			}
-
-			if !tt.wantErr {
-				var got string
-
-				got, err = keyring.Get(keyringService, tt.profile)
-				if err != nil {
-					t.Errorf("verification failed: %v", err)
-				}
-
-				if got != tt.value {
-					t.Errorf("stored value = %s, want %s", got, tt.value)
-				}
-			}
-		})
-	}
-}
-
-func TestKrDel(t *testing.T) {
-	tests := []struct {
-		setupFn func()
-		name    string
-		profile string
-		wantErr bool
-	}{
-		{
-			name:    "existing key",
-			profile: "delete-me",
-			setupFn: func() {
-				keyring.Set(keyringService, "delete-me", "value") //nolint:errcheck,gosec // ok
-			},
-		},
-		{
-			name:    "nonexistent key",
-			profile: "nonexistent",
-			setupFn: func() {},
-			wantErr: true,
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			keyring.MockInit()
-			tt.setupFn()
-
-			err := krDel(tt.profile)
-			if (err != nil) != tt.wantErr {
-				t.Fatalf("krDel() error = %v, wantErr %v", err, tt.wantErr)
-			}
-
-			if !tt.wantErr {
-				_, err = keyring.Get(keyringService, tt.profile)
-				if err == nil {
-					t.Error("key still exists after deletion")
-				}
-			}
-		})
-	}
-}
-
 func TestCredsLoad(t *testing.T) { //nolint:funlen // ok
 	validCreds := Creds{
 		Version:         1,
@@ -317,7 +217,7 @@ func TestCredsLoad(t *testing.T) { //nolint:funlen // ok
 
 			var c Creds
 
-			err := c.load(tt.profile)
+			err := c.load(keyringStore{}, tt.profile)
 			if (err != nil) != tt.wantErr {
 				t.Fatalf("load() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -366,7 +266,7 @@ func TestCredsStore(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			keyring.MockInit()
 
-			err := tt.creds.store(tt.profile)
+			err := tt.creds.store(keyringStore{}, tt.profile)
 			if (err != nil) != tt.wantErr {
 				t.Fatalf("store() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -386,8 +286,8 @@ func TestCredsStore(t *testing.T) {
 					t.Fatalf("json.Unmarshal() error = %v", err)
 				}
 
-				if retrieved.Version != 1 {
-					t.Errorf("Version = %d, want 1", retrieved.Version)
+				if retrieved.Version != credsVersion {
+					t.Errorf("Version = %d, want %d", retrieved.Version, credsVersion)
 				}
 
 				if retrieved.AccessKeyID != tt.creds.AccessKeyID {
@@ -451,7 +351,7 @@ func TestCredsApplyDefaults(t *testing.T) { //nolint:funlen // ok
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			tt.creds.applyDefaults(tt.cfg)
+			tt.creds.applyDefaults(&tt.cfg)
 
 			if tt.creds.SessionTTL != tt.wantTTL {
 				t.Errorf("SessionTTL = %v, want %v", tt.creds.SessionTTL, tt.wantTTL)
@@ -654,6 +554,7 @@ func TestAppAssumeRole(t *testing.T) { //nolint:funlen // ok
 
 	tests := []struct {
 		mockSTS     *mockSTSClient
+		ttyPrompt   func(string, *string) error
 		name        string
 		wantKeyID   string
 		baseCreds   Creds
@@ -707,16 +608,54 @@ func TestAppAssumeRole(t *testing.T) { //nolint:funlen // ok
 			targetCreds: Creds{RoleArn: "arn:aws:iam::123:role/test"},
 			wantErr:     true,
 		},
+		{
+			name: "MFA protected role",
+			mockSTS: &mockSTSClient{
+				assumeRoleFunc: func(ctx context.Context, input *sts.AssumeRoleInput, opts ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+					if aws.ToString(input.SerialNumber) != "arn:aws:iam::123:mfa/user" || aws.ToString(input.TokenCode) != "123456" {
+						return nil, errors.New("MFA required")
+					}
+
+					return &sts.AssumeRoleOutput{
+						Credentials: &types.Credentials{
+							AccessKeyId:     aws.String("ASIAMFA"),
+							SecretAccessKey: aws.String("tempsecret"),
+							SessionToken:    aws.String("token123"),
+							Expiration:      &expiration,
+						},
+					}, nil
+				},
+			},
+			ttyPrompt: func(label string, val *string) error {
+				*val = "123456"
+				return nil
+			},
+			baseCreds:   Creds{AccessKeyID: "AKIA123", SecretAccessKey: "secret123"},
+			targetCreds: Creds{RoleArn: "arn:aws:iam::123:role/test", MfaSerial: "arn:aws:iam::123:mfa/user"},
+			wantKeyID:   "ASIAMFA",
+		},
+		{
+			name:    "MFA prompt error",
+			mockSTS: &mockSTSClient{},
+			ttyPrompt: func(label string, val *string) error {
+				return errors.New("no terminal")
+			},
+			baseCreds:   Creds{AccessKeyID: "AKIA123", SecretAccessKey: "secret123"},
+			targetCreds: Creds{RoleArn: "arn:aws:iam::123:role/test", MfaSerial: "arn:aws:iam::123:mfa/user"},
+			wantErr:     true,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx := t.Context()
 			a := app{
+				store:       keyringStore{},
+				ttyPrompt:   tt.ttyPrompt,
 				mkSTSClient: func(aws.CredentialsProvider) stsAPI { return tt.mockSTS },
 			}
 
-			result, err := a.assumeRole(ctx, tt.baseCreds, tt.targetCreds)
+			result, err := a.assumeRole(ctx, "target", &tt.baseCreds, &tt.targetCreds)
 			if (err != nil) != tt.wantErr {
 				t.Fatalf("assumeRole() error = %v, wantErr %v", err, tt.wantErr)
 			}
@@ -728,6 +667,143 @@ func TestAppAssumeRole(t *testing.T) { //nolint:funlen // ok
 	}
 }
 
+func TestCredsAssumeRoleInput(t *testing.T) {
+	c := Creds{
+		RoleArn:           "arn:aws:iam::123:role/test",
+		SourceProfile:     "base",
+		SessionTTL:        time.Hour,
+		ExternalID:        "ext-123",
+		SourceIdentity:    "alice",
+		Tags:              map[string]string{"team": "ops", "cost": "42"},
+		TransitiveTagKeys: []string{"team"},
+		Policy:            `{"Version":"2012-10-17","Statement":[]}`,
+		PolicyArns:        []string{"arn:aws:iam::aws:policy/ReadOnlyAccess"},
+	}
+
+	in := c.assumeRoleInput("session")
+
+	if aws.ToString(in.ExternalId) != "ext-123" || aws.ToString(in.SourceIdentity) != "alice" || aws.ToString(in.Policy) != c.Policy {
+		t.Errorf("assumeRoleInput() = %+v", in)
+	}
+
+	if len(in.Tags) != 2 || aws.ToString(in.Tags[0].Key) != "cost" || aws.ToString(in.Tags[1].Value) != "ops" {
+		t.Errorf("Tags = %+v, want sorted cost, team", in.Tags)
+	}
+
+	if !slices.Equal(in.TransitiveTagKeys, []string{"team"}) {
+		t.Errorf("TransitiveTagKeys = %v", in.TransitiveTagKeys)
+	}
+
+	if len(in.PolicyArns) != 1 || aws.ToString(in.PolicyArns[0].Arn) != c.PolicyArns[0] {
+		t.Errorf("PolicyArns = %+v", in.PolicyArns)
+	}
+
+	empty := (&Creds{RoleArn: "arn:aws:iam::123:role/test"}).assumeRoleInput("session")
+	if empty.ExternalId != nil || empty.SourceIdentity != nil || empty.Policy != nil || empty.Tags != nil || empty.PolicyArns != nil {
+		t.Errorf("assumeRoleInput() with no options = %+v", empty)
+	}
+}
+
+func TestAppRoleSessionName(t *testing.T) {
+	tests := []struct {
+		name     string
+		global   string
+		profile  string
+		want     string
+		wantLike string
+		wantErr  bool
+	}{
+		{name: "default", want: "awbus-base"},
+		{name: "global template", global: "{profile}@{source}", want: "dev@base"},
+		{name: "profile overrides global", global: "{profile}", profile: "ci-{source}", want: "ci-base"},
+		{name: "user and date", global: "{user}.{date}", wantLike: `^[\w+=,.@-]+\.\d{8}$`},
+		{name: "invalid literal", global: "has space", wantErr: true},
+		{name: "too short", global: "x", wantErr: true},
+		{name: "too long, truncated", global: strings.Repeat("x", 65), want: strings.Repeat("x", 64)},
+		{name: "long expansion, truncated", global: "{profile}-" + strings.Repeat("y", 70), want: "dev-" + strings.Repeat("y", 60)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := app{store: keyringStore{}, config: config{AwbusRoleSessionName: tt.global}}
+			c := Creds{SourceProfile: "base", RoleSessionName: tt.profile}
+
+			got, err := a.roleSessionName("dev", &c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("roleSessionName() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.want != "" && got != tt.want {
+				t.Errorf("roleSessionName() = %s, want %s", got, tt.want)
+			}
+
+			if tt.wantLike != "" && !regexp.MustCompile(tt.wantLike).MatchString(got) {
+				t.Errorf("roleSessionName() = %s, want match %s", got, tt.wantLike)
+			}
+		})
+	}
+}
+
+func TestNewAppRoleSessionName(t *testing.T) {
+	t.Setenv("AWBUS_ROLE_SESSION_NAME", "{user}-ci")
+	t.Setenv("ROLE_SESSION_NAME", "unrelated")
+
+	if a, err := newApp(nil); err != nil || a.AwbusRoleSessionName != "{user}-ci" {
+		t.Errorf("newApp() AwbusRoleSessionName = %q, %v, want {user}-ci", a.AwbusRoleSessionName, err)
+	}
+}
+
+func TestCheckSessionNameTemplate(t *testing.T) {
+	for tmpl, wantErr := range map[string]bool{
+		"":                       false,
+		"{user}":                 false,
+		"ci-{profile}@{host}":    false,
+		strings.Repeat("x", 70):  false,
+		"{user}.{date}.{source}": false,
+		"x":                      true,
+		"has space":              true,
+		"{usr}":                  true,
+		"{user}/{profile}":       true,
+	} {
+		if err := checkSessionNameTemplate(tmpl); (err != nil) != wantErr {
+			t.Errorf("checkSessionNameTemplate(%q) error = %v, wantErr %v", tmpl, err, wantErr)
+		}
+	}
+}
+
+func TestSanitizeSessionName(t *testing.T) {
+	if got := sanitizeSessionName(`DOMAIN\jöe smith_1+=,.@-`); got != "DOMAIN-j-e-smith_1+=,.@-" {
+		t.Errorf("sanitizeSessionName() = %s", got)
+	}
+}
+
+func TestParseTags(t *testing.T) {
+	tests := []struct {
+		want    map[string]string
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "empty", input: ""},
+		{name: "pairs", input: "a=1, b=2,,c=", want: map[string]string{"a": "1", "b": "2", "c": ""}},
+		{name: "missing value separator", input: "a", wantErr: true},
+		{name: "missing key", input: "=1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseTags(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseTags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("parseTags() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestAppResolveAndMaybeRefresh(t *testing.T) { //nolint:funlen // ok
 	staticCreds := Creds{
 		Version:         1,
@@ -789,6 +865,22 @@ func TestAppResolveAndMaybeRefresh(t *testing.T) { //nolint:funlen // ok
 			},
 			wantKeyID: "ASIA789",
 		},
+		{
+			name:    "fresh cached role session",
+			profile: "role-profile",
+			setupFn: func() {
+				keyring.Set(keyringService, "base-profile", string(baseJSON))                                                                                                 //nolint:errcheck,gosec // ok
+				keyring.Set(keyringService, "role-profile", `{"Version":1,"RoleArn":"arn:aws:iam::123:role/test","SourceProfile":"base-profile"}`)                            //nolint:errcheck,gosec // ok
+				keyring.Set(sessionService, "role-profile", `{"Version":1,"AccessKeyId":"ASIA000","SecretAccessKey":"s","Expiration":"`+expiration.Format(time.RFC3339)+`"}`) //nolint:errcheck,gosec // ok
+			},
+			app: app{
+				config: config{
+					SkewPad:    120 * time.Second,
+					SessionTTL: 3600 * time.Second,
+				},
+			},
+			wantKeyID: "ASIA000",
+		},
 		{
 			name:    "nonexistent profile",
 			profile: "nonexistent",
@@ -900,6 +992,7 @@ func TestAppResolveAndMaybeRefresh(t *testing.T) { //nolint:funlen // ok
 			tt.setupFn()
 
 			ctx := t.Context()
+			tt.app.store = keyringStore{}
 
 			result, err := tt.app.resolveAndMaybeRefresh(ctx, tt.profile)
 			if (err != nil) != tt.wantErr {
@@ -913,6 +1006,246 @@ func TestAppResolveAndMaybeRefresh(t *testing.T) { //nolint:funlen // ok
 	}
 }
 
+func TestAppResolveChain(t *testing.T) { //nolint:funlen // ok
+	setRole := func(name, source string, exp time.Time) {
+		b, _ := json.Marshal(Creds{ //nolint:errcheck // ok
+			Version:         1,
+			RoleArn:         "arn:aws:iam::123:role/" + name,
+			SourceProfile:   source,
+			AccessKeyID:     "ASIA-" + name,
+			SecretAccessKey: "secret",
+			SessionTTL:      4 * time.Hour,
+			Expiration:      exp,
+		})
+		keyring.Set(keyringService, name, string(b)) //nolint:errcheck,gosec // ok
+	}
+	setStatic := func(name string) {
+		b, _ := json.Marshal(Creds{Version: 1, AccessKeyID: "AKIA-" + name, SecretAccessKey: "secret"}) //nolint:errcheck // ok
+		keyring.Set(keyringService, name, string(b))                                                    //nolint:errcheck,gosec // ok
+	}
+	stale, fresh := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+
+	tests := []struct {
+		setupFn   func()
+		name      string
+		profile   string
+		wantKeyID string
+		wantCalls []string
+		wantErr   bool
+	}{
+		{
+			name:    "two stale hops",
+			profile: "spoke",
+			setupFn: func() {
+				setStatic("base")
+				setRole("hub", "base", stale)
+				setRole("spoke", "hub", stale)
+			},
+			wantKeyID: "ASIA-new-spoke",
+			wantCalls: []string{"hub via AKIA-base for 14400s", "spoke via ASIA-new-hub for 3600s"},
+		},
+		{
+			name:    "fresh intermediate hop reused",
+			profile: "spoke",
+			setupFn: func() {
+				setStatic("base")
+				setRole("hub", "base", fresh)
+				setRole("spoke", "hub", stale)
+			},
+			wantKeyID: "ASIA-new-spoke",
+			wantCalls: []string{"spoke via ASIA-hub for 3600s"},
+		},
+		{
+			name:    "cycle",
+			profile: "a",
+			setupFn: func() {
+				setRole("a", "b", stale)
+				setRole("b", "a", stale)
+			},
+			wantErr: true,
+		},
+		{
+			name:    "too many hops",
+			profile: "r0",
+			setupFn: func() {
+				setStatic("base")
+
+				for i := range maxChainDepth + 1 {
+					setRole(fmt.Sprintf("r%d", i), fmt.Sprintf("r%d", i+1), stale)
+				}
+
+				setRole(fmt.Sprintf("r%d", maxChainDepth+1), "base", stale)
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+			tt.setupFn()
+
+			var calls []string
+
+			a := app{
+				store:  keyringStore{},
+				config: config{SkewPad: 2 * time.Minute, SessionTTL: time.Hour},
+				mkSTSClient: func(creds aws.CredentialsProvider) stsAPI {
+					return &mockSTSClient{
+						assumeRoleFunc: func(ctx context.Context, input *sts.AssumeRoleInput, opts ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+							c, _ := creds.Retrieve(ctx) //nolint:errcheck // ok
+							role := strings.TrimPrefix(*input.RoleArn, "arn:aws:iam::123:role/")
+							calls = append(calls, fmt.Sprintf("%s via %s for %ds", role, c.AccessKeyID, *input.DurationSeconds))
+
+							return &sts.AssumeRoleOutput{Credentials: &types.Credentials{
+								AccessKeyId:     aws.String("ASIA-new-" + role),
+								SecretAccessKey: aws.String("secret"),
+								SessionToken:    aws.String("token"),
+								Expiration:      aws.Time(time.Now().Add(time.Hour)),
+							}}, nil
+						},
+					}
+				},
+			}
+
+			got, err := a.resolveAndMaybeRefresh(t.Context(), tt.profile)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveAndMaybeRefresh() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got.AccessKeyID != tt.wantKeyID {
+				t.Errorf("AccessKeyID = %s, want %s", got.AccessKeyID, tt.wantKeyID)
+			}
+
+			if !slices.Equal(calls, tt.wantCalls) {
+				t.Errorf("AssumeRole calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestAppSessionToken(t *testing.T) { //nolint:funlen // ok
+	profileJSON, _ := json.Marshal(Creds{ //nolint:errcheck // ok
+		Version:         1,
+		AccessKeyID:     "AKIA123",
+		SecretAccessKey: "secret123",
+		MfaSerial:       "arn:aws:iam::123:mfa/user",
+		UseSessionToken: true,
+	})
+	cachedJSON, _ := json.Marshal(Creds{ //nolint:errcheck // ok
+		Version:         1,
+		AccessKeyID:     "ASIACACHED",
+		SecretAccessKey: "tempsecret",
+		SessionToken:    "token",
+		Expiration:      time.Now().Add(time.Hour),
+	})
+	okSTS := &mockSTSClient{
+		getSessionTokenFunc: func(ctx context.Context, input *sts.GetSessionTokenInput, opts ...func(*sts.Options)) (*sts.GetSessionTokenOutput, error) {
+			if aws.ToString(input.TokenCode) != "123456" || aws.ToInt32(input.DurationSeconds) != 3600 {
+				return nil, errors.New("bad input")
+			}
+
+			return &sts.GetSessionTokenOutput{Credentials: &types.Credentials{
+				AccessKeyId:     aws.String("ASIANEW"),
+				SecretAccessKey: aws.String("tempsecret"),
+				SessionToken:    aws.String("token"),
+				Expiration:      aws.Time(time.Now().Add(time.Hour)),
+			}}, nil
+		},
+	}
+	tests := []struct {
+		setupFn   func()
+		mockSTS   *mockSTSClient
+		name      string
+		wantKeyID string
+		wantErr   bool
+	}{
+		{
+			name: "fresh cached session",
+			setupFn: func() {
+				keyring.Set(sessionService, "p", string(cachedJSON)) //nolint:errcheck,gosec // ok
+			},
+			mockSTS:   &mockSTSClient{},
+			wantKeyID: "ASIACACHED",
+		},
+		{
+			name:      "no cached session",
+			setupFn:   func() {},
+			mockSTS:   okSTS,
+			wantKeyID: "ASIANEW",
+		},
+		{
+			name: "corrupt cached session",
+			setupFn: func() {
+				keyring.Set(sessionService, "p", "not json") //nolint:errcheck,gosec // ok
+			},
+			mockSTS:   okSTS,
+			wantKeyID: "ASIANEW",
+		},
+		{
+			name:    "STS error",
+			setupFn: func() {},
+			mockSTS: &mockSTSClient{
+				getSessionTokenFunc: func(ctx context.Context, input *sts.GetSessionTokenInput, opts ...func(*sts.Options)) (*sts.GetSessionTokenOutput, error) {
+					return nil, errors.New("access denied")
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "nil credentials",
+			setupFn: func() {},
+			mockSTS: &mockSTSClient{
+				getSessionTokenFunc: func(ctx context.Context, input *sts.GetSessionTokenInput, opts ...func(*sts.Options)) (*sts.GetSessionTokenOutput, error) {
+					return &sts.GetSessionTokenOutput{}, nil
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+			keyring.Set(keyringService, "p", string(profileJSON)) //nolint:errcheck,gosec // ok
+			tt.setupFn()
+
+			a := app{
+				store:  keyringStore{},
+				config: config{SkewPad: 2 * time.Minute, SessionTTL: time.Hour},
+				ttyPrompt: func(label string, val *string) error {
+					*val = "123456"
+					return nil
+				},
+				mkSTSClient: func(aws.CredentialsProvider) stsAPI { return tt.mockSTS },
+			}
+
+			got, err := a.resolveAndMaybeRefresh(t.Context(), "p")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveAndMaybeRefresh() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got.AccessKeyID != tt.wantKeyID {
+				t.Errorf("AccessKeyID = %s, want %s", got.AccessKeyID, tt.wantKeyID)
+			}
+
+			var profile Creds
+			if err = profile.load(keyringStore{}, "p"); err != nil || profile.AccessKeyID != "AKIA123" {
+				t.Errorf("long-term profile altered: %+v, %v", profile, err)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			var cached Creds
+			if err = cached.loadSession(keyringStore{}, "p"); err != nil || cached.AccessKeyID != tt.wantKeyID {
+				t.Errorf("cached session = %+v, %v", cached, err)
+			}
+		})
+	}
+}
+
 func TestAppRotateCredentials(t *testing.T) { //nolint:funlen // ok
 	staticCreds := Creds{
 		Version:         1,
@@ -1002,7 +1335,7 @@ func TestAppRotateCredentials(t *testing.T) { //nolint:funlen // ok
 			keyring.MockInit()
 			tt.setupFn()
 
-			a := app{iamAPI: tt.mockIAM}
+			a := app{store: keyringStore{}, iamAPI: tt.mockIAM}
 
 			err := a.rotateCredentials(t.Context(), tt.profile)
 			if (err != nil) != tt.wantErr {
@@ -1107,7 +1440,7 @@ func TestAppRun(t *testing.T) { //nolint:funlen // ok
 				switch label {
 				case "Profile Name (press Enter for 'default')":
 					*val = "assume-profile"
-				case "RoleArn":
+				case "RoleArn": //nolint:goconst // ok
 					*val = "arn:aws:iam::123:role/test"
 				case "SourceProfile":
 					*val = "base-profile"
@@ -1266,6 +1599,7 @@ func TestAppRun(t *testing.T) { //nolint:funlen // ok
 			tt.setupFn()
 
 			ctx := t.Context()
+			tt.app.store = keyringStore{}
 
 			if tt.mockPrompt != nil {
 				tt.app.prompt = tt.mockPrompt
@@ -1283,6 +1617,147 @@ func TestAppRun(t *testing.T) { //nolint:funlen // ok
 	}
 }
 
+func TestAppRunStore(t *testing.T) { //nolint:funlen,cyclop // ok
+	tests := []struct {
+		mockPrompt func(string, *string) error
+		name       string
+		args       []string
+		wantErr    bool
+	}{
+		{
+			name: "store-assume command with MFA",
+			args: []string{"awbus", "store-assume"},
+			mockPrompt: func(label string, val *string) error {
+				switch label {
+				case "Profile Name (press Enter for 'default')":
+					*val = "assume-mfa-profile"
+				case "RoleArn":
+					*val = "arn:aws:iam::123:role/test"
+				case "SourceProfile":
+					*val = "base-profile"
+				case "MfaSerial (press Enter to skip)":
+					*val = "arn:aws:iam::123:mfa/user"
+				}
+
+				return nil
+			},
+		},
+		{
+			name: "store-assume command with session options",
+			args: []string{"awbus", "store-assume"},
+			mockPrompt: func(label string, val *string) error {
+				switch label {
+				case "RoleArn":
+					*val = "arn:aws:iam::123:role/test"
+				case "SourceProfile":
+					*val = "base-profile"
+				case "ExternalId (press Enter to skip)":
+					*val = "ext-123"
+				case "Tags as key=value,... (press Enter to skip)":
+					*val = "team=ops"
+				case "TransitiveTagKeys as key,... (press Enter to skip)":
+					*val = "team"
+				case "Policy JSON (press Enter to skip)":
+					*val = `{"Version":"2012-10-17"}`
+				default:
+					return errors.New("skipped")
+				}
+
+				return nil
+			},
+		},
+		{
+			name: "store-assume command with invalid tags",
+			args: []string{"awbus", "store-assume"},
+			mockPrompt: func(label string, val *string) error {
+				*val = "no-equals-sign"
+				return nil
+			},
+			wantErr: true,
+		},
+		{
+			name: "store-assume command with invalid policy",
+			args: []string{"awbus", "store-assume"},
+			mockPrompt: func(label string, val *string) error {
+				switch label {
+				case "Tags as key=value,... (press Enter to skip)":
+					return errors.New("skipped")
+				case "Policy JSON (press Enter to skip)":
+					*val = "{not json"
+				default:
+					*val = "x"
+				}
+
+				return nil
+			},
+			wantErr: true,
+		},
+		{
+			name: "store-assume command with invalid RoleSessionName template",
+			args: []string{"awbus", "store-assume"},
+			mockPrompt: func(label string, val *string) error {
+				switch label {
+				case "RoleArn":
+					*val = "arn:aws:iam::123:role/test"
+				case "SourceProfile":
+					*val = "base-profile"
+				case "RoleSessionName template (press Enter for default)":
+					*val = "{usr} session"
+				default:
+					return errors.New("skipped")
+				}
+
+				return nil
+			},
+			wantErr: true,
+		},
+		{
+			name: "store command with session token",
+			args: []string{"awbus", "store"},
+			mockPrompt: func(label string, val *string) error {
+				switch label {
+				case "AccessKeyId":
+					*val = "AKIA999"
+				case "SecretAccessKey":
+					*val = "secret999"
+				case "Use GetSessionToken (y/N)":
+					*val = "y"
+				case "MfaSerial (press Enter to skip)":
+					*val = "arn:aws:iam::123:mfa/user"
+				default:
+					return errors.New("skipped")
+				}
+
+				return nil
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+
+			for _, name := range []string{"default", "assume-mfa-profile"} {
+				keyring.Set(sessionService, name, `{"Version":1}`) //nolint:errcheck,gosec // ok
+			}
+
+			a := app{store: keyringStore{}, config: config{AWSProfile: "default"}, prompt: tt.mockPrompt}
+
+			err := a.run(t.Context(), tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			names, _ := keyringStore{}.List(keyringService) //nolint:errcheck // ok
+			for _, name := range names {
+				if _, err = keyring.Get(sessionService, name); err == nil {
+					t.Errorf("session of replaced profile %q kept", name)
+				}
+			}
+		})
+	}
+}
+
 func TestP(t *testing.T) {
 	tests := []struct {
 		value any
@@ -1364,6 +1839,7 @@ func TestPromptIfEmpty(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			a := &app{
+				store: keyringStore{},
 				prompt: func(label string, val *string) error {
 					if tt.promptErr != nil {
 						return tt.promptErr
@@ -1410,6 +1886,7 @@ func TestEnsureIAMClient(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			a := &app{
+				store: keyringStore{},
 				config: config{
 					AWSRegion: "us-east-1",
 				},
@@ -1442,6 +1919,18 @@ func TestPrompt(t *testing.T) {
 			input:   "test-value\n",
 			wantVal: "test-value",
 		},
+		{
+			name:    "input with spaces",
+			label:   "test label",
+			input:   "  gh auth token \n",
+			wantVal: "gh auth token",
+		},
+		{
+			name:    "input without trailing newline",
+			label:   "test label",
+			input:   "last",
+			wantVal: "last",
+		},
 		{
 			name:    "empty input causes error",
 			label:   "test label",
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json/v2"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// renamedStore stores the awbus services of the wrapped store under another
+// name, e.g. to keep a second set of profiles in the same OS keyring.
+type renamedStore struct {
+	Store
+
+	name string
+}
+
+// migrateItem is a secret to migrate.
+type migrateItem struct {
+	service  string
+	username string
+}
+
+// migrate copies profiles, with the secrets they reference (TOTP seeds, web
+// identity tokens) and any named ones, from one store to another. Each copy
+// is read back and compared; the originals are only deleted, once everything
+// was copied, when asked to.
+func (a *app) migrate(w io.Writer, args []string) (err error) {
+	var (
+		from, to string
+		secrets  []string
+		del      bool
+	)
+
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&from, "from", "", "source store")
+	flags.StringVar(&to, "to", "", "destination store")
+	flags.BoolVar(&del, "delete", false, "delete from the source store")
+	flags.Func("secret", "generic secret as service/username", func(s string) error {
+		secrets = append(secrets, s)
+		return nil
+	})
+
+	if err = flags.Parse(args); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	if from == "" || to == "" {
+		return errors.New("migrate requires --from and --to stores")
+	}
+
+	src, err := a.openStore(from)
+	if err != nil {
+		return
+	}
+
+	dst, err := a.openStore(to)
+	if err != nil {
+		return
+	}
+
+	if storeLocation(src) == storeLocation(dst) {
+		return fmt.Errorf("migrate requires distinct --from and --to stores: both are %s", storeLocation(src))
+	}
+
+	if flags.NArg() == 0 {
+		a.backfillIndex(src)
+	}
+
+	items, err := migrateItems(src, flags.Args(), secrets)
+	if err != nil {
+		return
+	}
+
+	for _, it := range items {
+		if err = migrateCopy(src, dst, it); err != nil {
+			return
+		}
+
+		if _, err = fmt.Fprintf(w, "copied %s/%s\n", it.service, it.username); err != nil {
+			return
+		}
+	}
+
+	if del {
+		err = migrateDelete(w, src, items, from)
+	}
+
+	return
+}
+
+// migrateDelete deletes the migrated secrets (and profile sessions) from the
+// source store.
+func migrateDelete(w io.Writer, src Store, items []migrateItem, from string) (err error) {
+	for _, it := range items {
+		if err = src.Delete(it.service, it.username); err != nil {
+			return
+		}
+
+		if it.service == keyringService {
+			src.Delete(sessionService, it.username) //nolint:errcheck,gosec // Best effort, there may be none.
+		}
+
+		if _, err = fmt.Fprintf(w, "deleted %s/%s from %s\n", it.service, it.username, from); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// openStore opens a store given as backend[:location], where location is
+// the file (file, keepass), directory (pass), path prefix (vault) or service
+// name (keyring) to use instead of the configured one.
+func (a *app) openStore(spec string) (_ Store, err error) { //nolint:ireturn // Selected at runtime.
+	backend, location, _ := strings.Cut(spec, ":")
+
+	b := *a
+
+	switch backend {
+	case backendFile:
+		b.AwbusFile = location
+	case backendKeepass:
+		b.AwbusKeepassFile = location
+	case backendPass:
+		b.PasswordStoreDir = location
+	case backendVault:
+		b.AwbusVaultPath = location
+	}
+
+	st, err := b.newStore(backend)
+	if err != nil || location == "" || backend != backendKeyring {
+		return st, err
+	}
+
+	// The keyring indexes the services under their new name.
+	return renamedStore{Store: a.stampStore(keyringStore{name: location, lockDir: a.lockDir}), name: location}, nil
+}
+
+// storeLocation identifies the store as backend:location, with the effective
+// location, so that different spellings of the same store compare equal.
+func storeLocation(st Store) string {
+	abs := func(path string) string {
+		if p, err := filepath.Abs(path); err == nil {
+			return p
+		}
+
+		return path
+	}
+
+	switch s := st.(type) {
+	case stampedStore:
+		return storeLocation(s.Store)
+	case keyringStore:
+		return backendKeyring + ":" + cmp.Or(s.name, keyringService)
+	case renamedStore:
+		return backendKeyring + ":" + s.name
+	case *fileStore:
+		return backendFile + ":" + abs(s.path)
+	case *keepassStore:
+		return backendKeepass + ":" + abs(s.path)
+	case *passStore:
+		return backendPass + ":" + abs(s.dir)
+	case *vaultStore:
+		return backendVault + ":" + s.addr + "/" + s.mount + "/" + s.path
+	default:
+		return fmt.Sprintf("%T", st)
+	}
+}
+
+// migrateItems lists the profiles (all, if none named) followed by the
+// secrets they reference and the named secrets.
+func migrateItems(src Store, profiles, secrets []string) (items []migrateItem, err error) {
+	if len(profiles) == 0 {
+		if profiles, err = src.List(keyringService); err != nil {
+			return
+		}
+
+		if len(profiles) == 0 {
+			return nil, errors.New("no profiles to migrate: none are listed, name the ones stored by older versions")
+		}
+	}
+
+	for _, name := range profiles {
+		var c Creds
+
+		if err = c.load(src, name); err != nil {
+			return
+		}
+
+		items = append(items, migrateItem{keyringService, name})
+
+		if c.MfaTotp != "" {
+			secrets = append(secrets, totpService+"/"+c.MfaTotp)
+		}
+
+		if c.WebIdentityTokenKeyring != "" {
+			secrets = append(secrets, c.WebIdentityTokenKeyring)
+		}
+	}
+
+	for _, s := range secrets {
+		service, username, ok := strings.Cut(s, "/")
+		if !ok {
+			return nil, fmt.Errorf("invalid secret %q, want service/username", s)
+		}
+
+		if it := (migrateItem{service, username}); !slices.Contains(items, it) {
+			items = append(items, it)
+		}
+	}
+
+	return
+}
+
+// migrateCopy copies the secret and verifies it by reading it back.
+func migrateCopy(src, dst Store, it migrateItem) (err error) {
+	secret, err := src.Get(it.service, it.username)
+	if err != nil {
+		return
+	}
+
+	if err = dst.Set(it.service, it.username, secret); err != nil {
+		return
+	}
+
+	got, err := dst.Get(it.service, it.username)
+	if err != nil {
+		return fmt.Errorf("verify %s/%s: %w", it.service, it.username, err)
+	}
+
+	if !sameSecret(secret, got) {
+		return fmt.Errorf("verify %s/%s: copy differs from the original", it.service, it.username)
+	}
+
+	return
+}
+
+// sameSecret compares secrets, as JSON values when both are JSON.
+func sameSecret(x, y string) bool {
+	if x == y {
+		return true
+	}
+
+	var vx, vy any
+
+	if json.Unmarshal([]byte(x), &vx) != nil || json.Unmarshal([]byte(y), &vy) != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(vx, vy)
+}
+
+func (s renamedStore) Get(service, username string) (string, error) {
+	return s.Store.Get(s.rename(service), username)
+}
+
+func (s renamedStore) Set(service, username, secret string) error {
+	return s.Store.Set(s.rename(service), username, secret)
+}
+
+func (s renamedStore) Delete(service, username string) error {
+	return s.Store.Delete(s.rename(service), username)
+}
+
+func (s renamedStore) List(service string) ([]string, error) {
+	return s.Store.List(s.rename(service))
+}
+
+// rename maps awbus and awbus-* services to name and name-*.
+func (s renamedStore) rename(service string) string {
+	if rest, ok := strings.CutPrefix(service, keyringService); ok && (rest == "" || rest[0] == '-') {
+		return s.name + rest
+	}
+
+	return service
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestAppRunMigrate(t *testing.T) { //nolint:funlen // ok
+	file := filepath.Join(t.TempDir(), "export.enc")
+
+	tests := []struct {
+		name         string
+		to           string
+		wantErr      string
+		args         []string
+		wantCopied   []migrateItem
+		wantProfiles int
+		wantDeleted  bool
+	}{
+		{
+			name: "all profiles with referenced secrets",
+			to:   "keyring:awbus-old",
+			wantCopied: []migrateItem{
+				{keyringService, "mfa"}, {keyringService, "static"}, {totpService, "seed"},
+			},
+			wantProfiles: 2,
+		},
+		{
+			name:         "named profile and secret, to a file",
+			to:           "file:" + file,
+			args:         []string{"--secret", "svc/user", "static"},
+			wantCopied:   []migrateItem{{keyringService, "static"}, {"svc", "user"}},
+			wantProfiles: 1,
+		},
+		{
+			name:         "delete",
+			to:           "keyring:awbus-old",
+			args:         []string{"--delete", "mfa"},
+			wantCopied:   []migrateItem{{keyringService, "mfa"}, {totpService, "seed"}},
+			wantProfiles: 1,
+			wantDeleted:  true,
+		},
+		{name: "missing profile", to: "keyring:x", args: []string{"nope"}, wantErr: "not found"},
+		{name: "bad secret", to: "keyring:x", args: []string{"--secret", "svc"}, wantErr: "invalid secret"},
+		{name: "same store", to: "keyring", wantErr: "distinct"},
+		{name: "same store, spelled out", to: "keyring:awbus", args: []string{"--delete"}, wantErr: "distinct"},
+		{name: "unknown store", to: "floppy", wantErr: "unknown backend"},
+		{name: "unknown flag", to: "keyring:x", args: []string{"--purge"}, wantErr: "flag provided but not defined"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seedMigrateStore(t)
+
+			st := keyringStore{}
+			a := app{store: st, config: config{AwbusPassphrase: "hunter2"}}
+			out := &bytes.Buffer{}
+
+			err := a.migrate(out, append([]string{"--from", "keyring", "--to", tt.to}, tt.args...))
+
+			if _, gerr := st.Get(keyringService, "static"); gerr != nil {
+				t.Errorf("source profile error = %v", gerr) // Never deleted here.
+			}
+
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("run() error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("run() error = %v", err)
+			}
+
+			dst, err := a.openStore(tt.to)
+			if err != nil {
+				t.Fatalf("openStore() error = %v", err)
+			}
+
+			checkMigrated(t, st, dst, tt.wantCopied, tt.wantDeleted)
+			checkMigrateOutput(t, out.String(), tt.wantCopied, tt.wantDeleted)
+
+			if got, _ := dst.List(keyringService); len(got) != tt.wantProfiles { //nolint:errcheck // ok
+				t.Errorf("destination profiles = %v, want %d", got, tt.wantProfiles)
+			}
+		})
+	}
+}
+
+func checkMigrated(t *testing.T, src, dst Store, items []migrateItem, deleted bool) {
+	t.Helper()
+
+	for _, it := range items {
+		if got, err := dst.Get(it.service, it.username); err != nil || got == "" {
+			t.Errorf("destination %s/%s = %q, %v", it.service, it.username, got, err)
+		}
+
+		if _, err := src.Get(it.service, it.username); errors.Is(err, errNotFound) != deleted {
+			t.Errorf("source %s/%s error = %v, want deleted %v", it.service, it.username, err, deleted)
+		}
+	}
+}
+
+func checkMigrateOutput(t *testing.T, out string, items []migrateItem, deleted bool) {
+	t.Helper()
+
+	for _, it := range items {
+		if line := "copied " + it.service + "/" + it.username + "\n"; !strings.Contains(out, line) {
+			t.Errorf("output = %q, want %q", out, line)
+		}
+
+		if line := "deleted " + it.service + "/" + it.username + " from keyring\n"; strings.Contains(out, line) != deleted {
+			t.Errorf("output = %q, want %q listed: %v", out, line, deleted)
+		}
+	}
+}
+
+func seedMigrateStore(t *testing.T) {
+	t.Helper()
+
+	keyring.MockInit()
+
+	st := keyringStore{}
+	for _, it := range []struct{ service, username, secret string }{
+		{keyringService, "static", `{"Version":1,"AccessKeyId":"AKIA","SecretAccessKey":"s"}`},
+		{keyringService, "mfa", `{"Version":1,"RoleArn":"arn","MfaTotp":"seed"}`},
+		{sessionService, "mfa", `{"Version":1}`},
+		{totpService, "seed", "JBSWY3DPEHPK3PXP"},
+		{"svc", "user", "generic"},
+	} {
+		if err := st.Set(it.service, it.username, it.secret); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestAppMigrateUnindexed(t *testing.T) {
+	keyring.MockInit()
+	keyring.Set(keyringService, "old", `{"AccessKeyId":"AKIA","SecretAccessKey":"s"}`) //nolint:errcheck,gosec // No index.
+
+	ap := app{store: keyringStore{}}
+
+	if err := ap.migrate(io.Discard, []string{"--from", "keyring", "--to", "keyring:x"}); err == nil ||
+		!strings.Contains(err.Error(), "name the ones") {
+		t.Errorf("migrate() error = %v", err)
+	}
+
+	if err := ap.migrate(io.Discard, []string{"--from", "keyring", "--to", "keyring:x", "old"}); err != nil {
+		t.Errorf("migrate(old) error = %v", err)
+	}
+
+	if got, err := keyring.Get("x", "old"); err != nil || got == "" {
+		t.Errorf("migrated = %q, %v", got, err)
+	}
+}
+
+func TestStoreLocation(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Chdir(dir)
+
+	ap := app{}
+
+	for _, specs := range [][2]string{
+		{"keyring", "keyring:awbus"},
+		{"file", "file:" + filepath.Join(dir, "awbus", "secrets.enc")},
+		{"file:x.enc", "file:" + filepath.Join(dir, "x.enc")},
+		{"keepass", "keepass:" + filepath.Join(dir, "awbus", "awbus.kdbx")},
+		{"pass", "pass:" + filepath.Join(dir, ".password-store")},
+		{"vault", "vault:awbus"},
+	} {
+		x, err := ap.openStore(specs[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		y, err := ap.openStore(specs[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if storeLocation(x) != storeLocation(y) {
+			t.Errorf("storeLocation(%s) = %s, storeLocation(%s) = %s, want equal",
+				specs[0], storeLocation(x), specs[1], storeLocation(y))
+		}
+	}
+
+	old := storeLocation(renamedStore{Store: keyringStore{}, name: "awbus-old"})
+	if old == storeLocation(keyringStore{}) {
+		t.Errorf("storeLocation(keyring:awbus-old) = storeLocation(keyring) = %s", old)
+	}
+}
+
+func TestRenamedStore(t *testing.T) {
+	st := renamedStore{name: "old"}
+
+	for service, want := range map[string]string{
+		keyringService: "old", sessionService: "old-session", totpService: "old-totp", "awbusx": "awbusx", "svc": "svc",
+	} {
+		if got := st.rename(service); got != want {
+			t.Errorf("rename(%s) = %s, want %s", service, got, want)
+		}
+	}
+}
+
+func TestSameSecret(t *testing.T) {
+	tests := []struct {
+		x, y string
+		want bool
+	}{
+		{x: "a", y: "a", want: true},
+		{x: "a", y: "b"},
+		{x: `{"A":1,"B":[1,2]}`, y: "{\"B\": [1, 2],\n\"A\": 1}", want: true},
+		{x: `{"A":1}`, y: `{"A":2}`},
+		{x: `{"A":1}`, y: `not json`},
+	}
+
+	for _, tt := range tests {
+		if got := sameSecret(tt.x, tt.y); got != tt.want {
+			t.Errorf("sameSecret(%q, %q) = %v, want %v", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// passStore keeps each secret as a GPG encrypted file in a password-store
+// (pass, gopass) tree, at <dir>/<service>/<username>.gpg, so profiles show up
+// as awbus/<profile>. Files are encrypted to the nearest .gpg-id recipients
+// and, when the tree is a git repository, committed like pass does.
+type passStore struct {
+	dir string
+	gpg string
+}
+
+const (
+	backendPass      = "pass"
+	passExt          = ".gpg"
+	passGPGIDFile    = ".gpg-id"
+	defaultPassStore = ".password-store"
+)
+
+func newPassStore(cfg *config) (ps *passStore, err error) {
+	ps = &passStore{dir: cfg.PasswordStoreDir, gpg: "gpg"}
+
+	if ps.dir == "" {
+		var home string
+
+		if home, err = os.UserHomeDir(); err != nil {
+			return nil, fmt.Errorf("pass backend: %w", err)
+		}
+
+		ps.dir = filepath.Join(home, defaultPassStore)
+	}
+
+	return
+}
+
+func (ps *passStore) Get(service, username string) (string, error) {
+	path := ps.path(service, username)
+
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("%s/%s: %w", service, username, errNotFound)
+	}
+
+	out, err := ps.run(nil, "--quiet", "--batch", "--yes", "--decrypt", path)
+	if err != nil {
+		return "", fmt.Errorf("decrypt %s: %w", path, err)
+	}
+
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+func (ps *passStore) Set(service, username, secret string) (err error) {
+	path := ps.path(service, username)
+
+	recipients, err := ps.recipients(filepath.Dir(path))
+	if err != nil {
+		return
+	}
+
+	if err = os.MkdirAll(filepath.Dir(path), privateDirMode); err != nil {
+		return
+	}
+
+	args := []string{"--quiet", "--batch", "--yes", "--encrypt", "--output", path + ".tmp"}
+	for _, r := range recipients {
+		args = append(args, "--recipient", r)
+	}
+
+	if _, err = ps.run([]byte(secret+"\n"), args...); err != nil {
+		os.Remove(path + ".tmp") //nolint:errcheck,gosec // ok
+		return fmt.Errorf("encrypt %s: %w", path, err)
+	}
+
+	if err = os.Rename(path+".tmp", path); err != nil {
+		return
+	}
+
+	return ps.commit(path, "Add given password for "+service+"/"+username+" to store.")
+}
+
+func (ps *passStore) Delete(service, username string) (err error) {
+	path := ps.path(service, username)
+
+	if err = os.Remove(path); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s/%s: %w", service, username, errNotFound)
+	} else if err != nil {
+		return
+	}
+
+	os.Remove(filepath.Dir(path)) //nolint:errcheck,gosec // Only if empty, like pass rm.
+
+	return ps.commit(path, "Remove "+service+"/"+username+" from store.")
+}
+
+func (ps *passStore) List(service string) (names []string, err error) {
+	entries, err := os.ReadDir(filepath.Join(ps.dir, filepath.FromSlash(service)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), passExt)
+		if e.IsDir() || !ok {
+			continue
+		}
+
+		if name, err = url.PathUnescape(name); err != nil {
+			return
+		}
+
+		names = append(names, name)
+	}
+
+	slices.Sort(names)
+
+	return
+}
+
+// path maps service/username to the entry file; usernames may contain
+// slashes (e.g. SSO start URLs), so they are escaped.
+func (ps *passStore) path(service, username string) string {
+	return filepath.Join(ps.dir, filepath.FromSlash(service), url.PathEscape(username)+passExt)
+}
+
+// recipients reads the .gpg-id nearest to dir, walking up to the store root.
+func (ps *passStore) recipients(dir string) (ids []string, err error) {
+	for {
+		raw, rerr := os.ReadFile(filepath.Join(dir, passGPGIDFile)) //nolint:gosec // ok
+		if rerr == nil {
+			for line := range strings.Lines(string(raw)) {
+				if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+					ids = append(ids, line)
+				}
+			}
+
+			if len(ids) == 0 {
+				return nil, fmt.Errorf("%s has no recipients", filepath.Join(dir, passGPGIDFile))
+			}
+
+			return
+		}
+
+		if !errors.Is(rerr, os.ErrNotExist) {
+			return nil, rerr
+		}
+
+		if rel, _ := filepath.Rel(ps.dir, dir); rel == "." || strings.HasPrefix(rel, "..") { //nolint:errcheck // ok
+			return nil, fmt.Errorf("no %s found in password store %s (run 'pass init')", passGPGIDFile, ps.dir)
+		}
+
+		dir = filepath.Dir(dir)
+	}
+}
+
+func (ps *passStore) commit(path, msg string) (err error) {
+	if _, err = os.Stat(filepath.Join(ps.dir, ".git")); err != nil {
+		return nil //nolint:nilerr // Not a git repository.
+	}
+
+	git := func(args ...string) error {
+		args = append([]string{"-C", ps.dir}, args...)
+
+		cmd := exec.CommandContext(context.Background(), "git", args...)
+		if out, gerr := cmd.CombinedOutput(); gerr != nil {
+			return fmt.Errorf("git %s: %w: %s", args[2], gerr, bytes.TrimSpace(out))
+		}
+
+		return nil
+	}
+
+	rel, err := filepath.Rel(ps.dir, path)
+	if err != nil {
+		return
+	}
+
+	if err = git("add", "--all", "--", rel); err != nil {
+		return
+	}
+
+	return git("commit", "--quiet", "--message", msg, "--", rel)
+}
+
+func (ps *passStore) run(stdin []byte, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(context.Background(), ps.gpg, args...) //nolint:gosec // ok
+	cmd.Stdin = bytes.NewReader(stdin)
+
+	var stderr bytes.Buffer
+
+	cmd.Stderr = &stderr
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+
+	return out, nil
+}
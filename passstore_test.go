@@ -0,0 +1,149 @@
+//nolint:lll // ok
+package main
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestPassStore initializes a password store with a throwaway GPG key.
+func newTestPassStore(t *testing.T) *passStore {
+	t.Helper()
+
+	if _, err := exec.LookPath("gpg"); err != nil {
+		t.Skip("gpg not installed")
+	}
+
+	home, err := os.MkdirTemp("", "gpg") //nolint:usetesting // Short, for the gpg-agent socket path.
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("GNUPGHOME", home)
+	t.Cleanup(func() {
+		exec.Command("gpgconf", "--kill", "gpg-agent").Run() //nolint:errcheck,gosec,noctx // ok
+		os.RemoveAll(home)                                   //nolint:errcheck,gosec // ok
+	})
+
+	gen := exec.Command("gpg", "--batch", "--passphrase", "", "--quick-gen-key", //nolint:noctx // ok
+		"awbus-test@example.com", "future-default", "default", "never")
+	if out, gerr := gen.CombinedOutput(); gerr != nil {
+		t.Skipf("gpg key generation unavailable: %v: %s", gerr, out)
+	}
+
+	ps, err := newPassStore(&config{PasswordStoreDir: filepath.Join(t.TempDir(), "store")})
+	if err != nil {
+		t.Fatalf("newPassStore() error = %v", err)
+	}
+
+	os.MkdirAll(ps.dir, privateDirMode)                                                                     //nolint:errcheck,gosec // ok
+	os.WriteFile(filepath.Join(ps.dir, passGPGIDFile), []byte("awbus-test@example.com\n"), privateFileMode) //nolint:errcheck,gosec // ok
+
+	return ps
+}
+
+func TestPassStore(t *testing.T) {
+	ps := newTestPassStore(t)
+
+	if _, err := ps.Get(keyringService, "p"); !errors.Is(err, errNotFound) {
+		t.Errorf("Get() missing error = %v, want %v", err, errNotFound)
+	}
+
+	for _, name := range []string{"b", "a", "https://x.awsapps.com/start"} {
+		if err := ps.Set(keyringService, name, `{"Version":1}`); err != nil {
+			t.Fatalf("Set(%s) error = %v", name, err)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(ps.dir, keyringService, "a.gpg")); err != nil {
+		t.Errorf("entry not stored as awbus/a.gpg: %v", err)
+	}
+
+	if got, err := ps.Get(keyringService, "a"); err != nil || got != `{"Version":1}` {
+		t.Errorf("Get() = %s, %v", got, err)
+	}
+
+	if got, err := ps.List(keyringService); err != nil || !slices.Equal(got, []string{"a", "b", "https://x.awsapps.com/start"}) {
+		t.Errorf("List() = %v, %v", got, err)
+	}
+
+	if err := ps.Delete(keyringService, "a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if err := ps.Delete(keyringService, "a"); !errors.Is(err, errNotFound) {
+		t.Errorf("Delete() twice error = %v, want %v", err, errNotFound)
+	}
+
+	if got, err := ps.List("missing"); err != nil || len(got) != 0 {
+		t.Errorf("List(missing) = %v, %v", got, err)
+	}
+}
+
+func TestPassStoreGit(t *testing.T) {
+	ps := newTestPassStore(t)
+
+	git := func(args ...string) string {
+		out, err := exec.Command("git", append([]string{"-C", ps.dir}, args...)...).CombinedOutput() //nolint:gosec,noctx // ok
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+
+		return string(out)
+	}
+
+	git("init", "--quiet")
+	git("config", "user.email", "awbus-test@example.com")
+	git("config", "user.name", "awbus test")
+
+	if err := ps.Set("svc", "user", "secret"); err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if err := ps.Delete("svc", "user"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if log := git("log", "--format=%s"); !strings.Contains(log, "Add given password for svc/user") ||
+		!strings.Contains(log, "Remove svc/user") {
+		t.Errorf("git log = %s", log)
+	}
+}
+
+func TestPassStoreRecipients(t *testing.T) {
+	root := t.TempDir()
+	ps := &passStore{dir: root}
+
+	os.MkdirAll(filepath.Join(root, "team", "sub"), privateDirMode)                                                     //nolint:errcheck,gosec // ok
+	os.WriteFile(filepath.Join(root, passGPGIDFile), []byte("me@example.com\n"), privateFileMode)                       //nolint:errcheck,gosec // ok
+	os.WriteFile(filepath.Join(root, "team", passGPGIDFile), []byte("a@example.com\nb@example.com\n"), privateFileMode) //nolint:errcheck,gosec // ok
+
+	tests := []struct {
+		name    string
+		dir     string
+		want    []string
+		wantErr bool
+	}{
+		{name: "root", dir: root, want: []string{"me@example.com"}},
+		{name: "nearest", dir: filepath.Join(root, "team", "sub"), want: []string{"a@example.com", "b@example.com"}},
+		{name: "outside store", dir: t.TempDir(), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ps.recipients(tt.dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("recipients() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("recipients() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+//go:build darwin
+
+package main
+
+import (
+	"cmp"
+	"net"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCredentials tells whether peerUID is supported.
+const peerCredentials = true
+
+// peerUID is the user ID of the process at the other end of conn.
+func peerUID(conn *net.UnixConn) (uid int, err error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return
+	}
+
+	var cred *unix.Xucred
+
+	cerr := raw.Control(func(fd uintptr) {
+		cred, err = unix.GetsockoptXucred(int(fd), unix.SOL_LOCAL, unix.LOCAL_PEERCRED)
+	})
+	if err = cmp.Or(cerr, err); err != nil {
+		return
+	}
+
+	return int(cred.Uid), nil
+}
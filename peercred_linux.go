@@ -0,0 +1,31 @@
+//go:build linux
+
+package main
+
+import (
+	"cmp"
+	"net"
+	"syscall"
+)
+
+// peerCredentials tells whether peerUID is supported.
+const peerCredentials = true
+
+// peerUID is the user ID of the process at the other end of conn.
+func peerUID(conn *net.UnixConn) (uid int, err error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return
+	}
+
+	var cred *syscall.Ucred
+
+	cerr := raw.Control(func(fd uintptr) {
+		cred, err = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err = cmp.Or(cerr, err); err != nil {
+		return
+	}
+
+	return int(cred.Uid), nil
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const defaultRefreshTimeout = time.Minute
+
+// refreshLockDir is the directory for the refresh locks: the user's runtime
+// directory, else their cache directory; none if neither is known.
+func refreshLockDir() string {
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		var err error
+		if dir, err = os.UserCacheDir(); err != nil {
+			return ""
+		}
+	}
+
+	return filepath.Join(dir, keyringService)
+}
+
+// lockRefresh takes the refresh lock of the profile, so concurrent awbus
+// processes (e.g. terraform providers) don't all refresh the same session:
+// one does, the others wait, up to AwbusRefreshTimeout, and then find it
+// fresh.
+func (a *app) lockRefresh(name string) (unlock func(), err error) {
+	if a.lockDir == "" {
+		return func() {}, nil
+	}
+
+	if err = os.MkdirAll(a.lockDir, privateDirMode); err != nil {
+		return nil, fmt.Errorf("refresh lock: %w", err)
+	}
+
+	unlock, err = lockFile(filepath.Join(a.lockDir, url.PathEscape(name)+".lock"),
+		cmp.Or(a.AwbusRefreshTimeout, defaultRefreshTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("profile %q is being refreshed by another process: %w", name, err)
+	}
+
+	return
+}
@@ -0,0 +1,101 @@
+//nolint:lll // ok
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+)
+
+func TestAppRefreshLock(t *testing.T) {
+	cfg := config{AwbusPassphrase: "hunter2", SessionTTL: time.Hour, SkewPad: time.Minute}
+	st := newTestFileStore(t, &cfg)
+	lockDir := t.TempDir()
+
+	for name, c := range map[string]Creds{
+		"base": {AccessKeyID: "AKIA", SecretAccessKey: "s"},
+		"role": {RoleArn: "arn:aws:iam::123456789012:role/r", SourceProfile: "base"},
+		"mfa":  {AccessKeyID: "AKIA", SecretAccessKey: "s", UseSessionToken: true},
+	} {
+		if err := c.store(st, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var calls atomic.Int32
+
+	creds := func() *types.Credentials {
+		calls.Add(1)
+		time.Sleep(50 * time.Millisecond)
+
+		return &types.Credentials{
+			AccessKeyId: aws.String("ASIA"), SecretAccessKey: aws.String("s"), SessionToken: aws.String("t"),
+			Expiration: aws.Time(time.Now().Add(time.Hour)),
+		}
+	}
+	mock := &mockSTSClient{
+		assumeRoleFunc: func(context.Context, *sts.AssumeRoleInput, ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+			return &sts.AssumeRoleOutput{Credentials: creds()}, nil
+		},
+		getSessionTokenFunc: func(context.Context, *sts.GetSessionTokenInput, ...func(*sts.Options)) (*sts.GetSessionTokenOutput, error) {
+			return &sts.GetSessionTokenOutput{Credentials: creds()}, nil
+		},
+	}
+
+	for _, name := range []string{"role", "mfa"} {
+		t.Run(name, func(t *testing.T) {
+			calls.Store(0)
+
+			var wg sync.WaitGroup
+
+			// Each app stands for an awbus process.
+			for range 5 {
+				ap := app{
+					store: st, config: cfg, lockDir: lockDir,
+					mkSTSClient: func(aws.CredentialsProvider) stsAPI { return mock },
+				}
+				ap.AwbusRefreshTimeout = 10 * time.Second
+
+				wg.Go(func() {
+					if c, err := ap.resolveAndMaybeRefresh(t.Context(), name); err != nil || c.SessionToken != "t" {
+						t.Errorf("resolveAndMaybeRefresh() = %+v, %v", c, err)
+					}
+				})
+			}
+
+			wg.Wait()
+
+			if got := calls.Load(); got != 1 {
+				t.Errorf("refreshed %d times, want 1", got)
+			}
+		})
+	}
+}
+
+func TestAppRefreshLockTimeout(t *testing.T) {
+	ap := app{lockDir: t.TempDir()}
+	ap.AwbusRefreshTimeout = 100 * time.Millisecond
+
+	unlock, err := ap.lockRefresh("p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer unlock()
+
+	if _, err = ap.lockRefresh("p"); err == nil || !strings.Contains(err.Error(), "being refreshed by another process") {
+		t.Errorf("lockRefresh() error = %v", err)
+	}
+
+	if other, oerr := ap.lockRefresh("other/profile"); oerr != nil {
+		t.Errorf("lockRefresh(other) error = %v", oerr)
+	} else {
+		other()
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultServeAddr = "127.0.0.1:0"
+	serverTimeout    = 10 * time.Second
+)
+
+// serveECS serves the credentials of a profile from a container credentials
+// endpoint until interrupted, printing the environment that points SDKs
+// (e.g. in containers using the host network) to it.
+func (a *app) serveECS(ctx context.Context, w io.Writer, args []string) (err error) {
+	name, addr := a.AWSProfile, defaultServeAddr
+
+	flags := flag.NewFlagSet("serve-ecs", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.StringVar(&name, "profile", name, "profile")
+	flags.StringVar(&addr, "addr", addr, "listen address")
+
+	if err = flags.Parse(args); err != nil {
+		return fmt.Errorf("serve-ecs: %w", err)
+	}
+
+	// Fail early (and get any MFA prompt out of the way) on a bad profile.
+	if _, err = a.resolveAndMaybeRefresh(ctx, name); err != nil {
+		return
+	}
+
+	uri, token, stop, err := a.serveContainerCredentials(ctx, addr, name)
+	if err != nil {
+		return
+	}
+	defer stop()
+
+	for _, v := range []envVar{
+		{"AWS_CONTAINER_CREDENTIALS_FULL_URI", uri},
+		{"AWS_CONTAINER_AUTHORIZATION_TOKEN", token},
+	} {
+		if _, err = fmt.Fprintln(w, envLine("dotenv", v)); err != nil {
+			return
+		}
+	}
+
+	waitForInterrupt(ctx)
+
+	return
+}
+
+// startServer serves h on addr in the background, until stopped. Responses
+// are sent with a hop limit of 1 so they cannot leave the host's network.
+func startServer(ctx context.Context, addr string, h http.Handler) (bound string, stop func(), err error) {
+	ln, err := (&net.ListenConfig{Control: limitHops}).Listen(ctx, "tcp", addr)
+	if err != nil {
+		return
+	}
+
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: serverTimeout}
+
+	go srv.Serve(ln) //nolint:errcheck // Stopped by Close.
+
+	return ln.Addr().String(), func() { srv.Close() }, nil //nolint:errcheck,gosec // ok
+}
+
+// waitForInterrupt waits for ctx to be done or awbus to be interrupted.
+func waitForInterrupt(ctx context.Context) {
+	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	<-ctx.Done()
+}
@@ -0,0 +1,55 @@
+//nolint:lll // ok
+package main
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/credentials/endpointcreds"
+	"github.com/zalando/go-keyring"
+)
+
+func TestAppServeECS(t *testing.T) {
+	keyring.MockInit()
+	keyring.Set(keyringService, "static", `{"Version":1,"AccessKeyId":"AKIA","SecretAccessKey":"s"}`) //nolint:errcheck,gosec // ok
+
+	ap := app{store: keyringStore{}, config: config{AWSProfile: "static"}}
+
+	if err := ap.serveECS(t.Context(), io.Discard, []string{"--profile", "nope"}); err == nil {
+		t.Error("serveECS() missing profile error = nil")
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	pr, pw := io.Pipe()
+	errc := make(chan error, 1)
+
+	go func() {
+		errc <- ap.serveECS(ctx, pw, nil)
+
+		pw.Close() //nolint:errcheck,gosec // ok
+	}()
+
+	env := map[string]string{}
+	scanner := bufio.NewScanner(pr)
+
+	for len(env) < 2 && scanner.Scan() {
+		name, value, _ := strings.Cut(scanner.Text(), "=")
+		env[name] = value
+	}
+
+	uri, token := env["AWS_CONTAINER_CREDENTIALS_FULL_URI"], env["AWS_CONTAINER_AUTHORIZATION_TOKEN"]
+
+	got, err := endpointcreds.New(uri, func(o *endpointcreds.Options) { o.AuthorizationToken = token }).Retrieve(ctx)
+	if err != nil || got.AccessKeyID != "AKIA" {
+		t.Errorf("Retrieve() = %+v, %v", got, err)
+	}
+
+	cancel()
+
+	if err = <-errc; err != nil {
+		t.Errorf("serveECS() error = %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// profileView is a profile with its secrets masked, as printed by show.
+// Fresh is whether load would use the cached session (Session) as it is,
+// i.e. it does not expire within SkewPad; static credentials always are.
+type profileView struct { //nolint:govet // ok
+	Creds `json:",inline"`
+
+	Name    string `json:"Name"`
+	Type    string `json:"Type"`
+	Session *Creds `json:"Session,omitempty"`
+	Fresh   bool   `json:"Fresh"`
+}
+
+const redacted = "<redacted>"
+
+// show prints the named (else the current) profile, with the effective
+// SessionTTL and SkewPad, but without its secrets.
+func (a *app) show(w io.Writer, args []string, now time.Time) (err error) {
+	name := a.AWSProfile
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	view := profileView{Name: name}
+
+	if err = view.load(a.store, name); err != nil {
+		return fmt.Errorf("profile %q: %w", name, err)
+	}
+
+	view.applyDefaults(&a.config)
+	view.Type, view.Fresh = view.kind(), view.credsFresh(now)
+
+	if view.cachesSession() {
+		var session Creds
+
+		if err = session.loadSession(a.store, name); err != nil && !errors.Is(err, errNotFound) {
+			return fmt.Errorf("profile %q session: %w", name, err)
+		}
+
+		if err == nil {
+			session.mask()
+			view.Session = &session
+		}
+
+		view.Fresh = session.sessionFresh(now, view.SkewPad)
+	}
+
+	view.mask()
+
+	return json.MarshalWrite(w, view, jsontext.WithIndent("  "))
+}
+
+// mask keeps the last 4 characters of the access key ID and redacts the
+// secret access key and session token.
+func (c *Creds) mask() {
+	if n := len(c.AccessKeyID); n > 4 { //nolint:mnd // ok
+		c.AccessKeyID = strings.Repeat("*", n-4) + c.AccessKeyID[n-4:] //nolint:mnd // ok
+	} else if n > 0 {
+		c.AccessKeyID = redacted
+	}
+
+	if c.SecretAccessKey != "" {
+		c.SecretAccessKey = redacted
+	}
+
+	if c.SessionToken != "" {
+		c.SessionToken = redacted
+	}
+}
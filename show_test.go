@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json/v2"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestAppShow(t *testing.T) { //nolint:funlen // ok
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name        string
+		profile     string
+		session     string
+		wantKeyID   string
+		wantTTL     string
+		wantErr     string
+		wantSession bool
+		wantFresh   bool
+	}{
+		{
+			name:      "static",
+			profile:   `{"Version":1,"AccessKeyId":"AKIAEXAMPLE1234","SecretAccessKey":"topsecret"}`,
+			wantKeyID: "***********1234", wantTTL: "1h0m0s", wantFresh: true,
+		},
+		{
+			name:    "fresh role",
+			profile: `{"Version":1,"RoleArn":"arn:role","SourceProfile":"base","SessionTTL":"5m"}`,
+			session: `{"Version":1,"AccessKeyId":"ASIAEXAMPLE","SecretAccessKey":"topsecret","SessionToken":"topsecret",` +
+				`"Expiration":"2025-01-15T10:05:00Z"}`,
+			wantTTL: "15m0s", wantSession: true, wantFresh: true,
+		},
+		{
+			name: "role stored with its session",
+			profile: `{"Version":1,"AccessKeyId":"ASIAEXAMPLE","SecretAccessKey":"topsecret","SessionToken":"topsecret",` +
+				`"RoleArn":"arn:role","SourceProfile":"base","Expiration":"2025-01-15T10:05:00Z","SessionTTL":"5m"}`,
+			wantTTL: "15m0s", wantSession: true, wantFresh: true,
+		},
+		{
+			name:    "role expiring within skew pad",
+			profile: `{"Version":1,"RoleArn":"arn:role","SourceProfile":"base","SessionTTL":"24h","SkewPad":"10m"}`,
+			session: `{"Version":1,"AccessKeyId":"ASIA","SecretAccessKey":"topsecret","Expiration":"2025-01-15T10:05:00Z"}`,
+			wantTTL: "12h0m0s", wantSession: true,
+		},
+		{
+			name:    "role without session",
+			profile: `{"Version":1,"RoleArn":"arn:role","SourceProfile":"base"}`,
+			wantTTL: "1h0m0s",
+		},
+		{
+			name:      "session token",
+			profile:   `{"Version":1,"AccessKeyId":"AKIAEXAMPLE1234","SecretAccessKey":"topsecret","UseSessionToken":true}`,
+			session:   `{"Version":1,"AccessKeyId":"ASIA","SecretAccessKey":"topsecret","Expiration":"2025-01-15T11:00:00Z"}`,
+			wantKeyID: "***********1234", wantTTL: "1h0m0s", wantSession: true, wantFresh: true,
+		},
+		{
+			name:      "session token without session",
+			profile:   `{"Version":1,"AccessKeyId":"AKIAEXAMPLE1234","SecretAccessKey":"topsecret","UseSessionToken":true}`,
+			wantKeyID: "***********1234", wantTTL: "1h0m0s",
+		},
+		{name: "missing", wantErr: "not found"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+
+			st := keyringStore{}
+			if tt.profile != "" {
+				st.Set(keyringService, "p", tt.profile) //nolint:errcheck,gosec // ok
+			}
+
+			if tt.session != "" {
+				st.Set(sessionService, "p", tt.session) //nolint:errcheck,gosec // ok
+			}
+
+			ap := app{store: st, config: config{SessionTTL: time.Hour, SkewPad: 2 * time.Minute}}
+
+			var buf bytes.Buffer
+
+			err := ap.show(&buf, []string{"p"}, now)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("show() error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("show() error = %v", err)
+			}
+
+			if strings.Contains(buf.String(), "topsecret") {
+				t.Errorf("show() = %s, leaks secrets", buf.String())
+			}
+
+			var got struct {
+				AccessKeyID string `json:"AccessKeyId"`
+				SessionTTL  string `json:"SessionTTL"` //nolint:tagliatelle // ok
+				Session     *Creds `json:"Session"`
+				Name        string `json:"Name"`
+				Fresh       bool   `json:"Fresh"`
+			}
+
+			if err = json.Unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("show() output %s: %v", buf.String(), err)
+			}
+
+			if got.Name != "p" || got.AccessKeyID != tt.wantKeyID || got.SessionTTL != tt.wantTTL ||
+				(got.Session != nil) != tt.wantSession || got.Fresh != tt.wantFresh {
+				t.Errorf("show() = %s", buf.String())
+			}
+		})
+	}
+}
+
+func TestCredsMask(t *testing.T) {
+	c := Creds{AccessKeyID: "AKIA", SecretAccessKey: "s", RoleArn: "arn"}
+	c.mask()
+
+	if c.AccessKeyID != redacted || c.SecretAccessKey != redacted || c.SessionToken != "" || c.RoleArn != "arn" {
+		t.Errorf("mask() = %+v", c)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// forwardedSignals are the signals exec passes on to the command.
+func forwardedSignals() []os.Signal {
+	return nil
+}
+
+// ignoredSignals are the signals exec ignores while the command runs; the
+// console delivers Ctrl+C to it anyway, awbus only has to outlive it.
+func ignoredSignals() []os.Signal {
+	return []os.Signal{os.Interrupt}
+}
+
+// exitCode is the exit code of the process.
+func exitCode(state *os.ProcessState) int {
+	return state.ExitCode()
+}
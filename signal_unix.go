@@ -0,0 +1,30 @@
+//go:build unix
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// forwardedSignals are the signals exec passes on to the command.
+func forwardedSignals() []os.Signal {
+	return []os.Signal{syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR1, syscall.SIGUSR2}
+}
+
+// ignoredSignals are the signals exec ignores while the command runs: the
+// terminal sends them to its whole process group, the command included,
+// which must not get them twice (e.g. a second Ctrl+C aborts terraform).
+func ignoredSignals() []os.Signal {
+	return []os.Signal{syscall.SIGINT, syscall.SIGQUIT}
+}
+
+// exitCode is the exit code of the process, as shells report it: 128 plus
+// the signal number when it was killed by a signal.
+func exitCode(state *os.ProcessState) int {
+	if ws, ok := state.Sys().(syscall.WaitStatus); ok && ws.Signaled() {
+		return 128 + int(ws.Signal()) //nolint:mnd // ok
+	}
+
+	return state.ExitCode()
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sso"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	ssooidctypes "github.com/aws/aws-sdk-go-v2/service/ssooidc/types"
+)
+
+//nolint:inamedparam,lll // ok
+type ssoOIDCAPI interface {
+	RegisterClient(context.Context, *ssooidc.RegisterClientInput, ...func(*ssooidc.Options)) (*ssooidc.RegisterClientOutput, error)
+	StartDeviceAuthorization(context.Context, *ssooidc.StartDeviceAuthorizationInput, ...func(*ssooidc.Options)) (*ssooidc.StartDeviceAuthorizationOutput, error)
+	CreateToken(context.Context, *ssooidc.CreateTokenInput, ...func(*ssooidc.Options)) (*ssooidc.CreateTokenOutput, error)
+}
+
+//nolint:inamedparam,lll // ok
+type ssoAPI interface {
+	GetRoleCredentials(context.Context, *sso.GetRoleCredentialsInput, ...func(*sso.Options)) (*sso.GetRoleCredentialsOutput, error)
+}
+
+// ssoToken is the SSO session for a start URL, shared by all the profiles
+// using it; it replaces ~/.aws/sso/cache.
+type ssoToken struct {
+	ClientExpiresAt time.Time `json:"ClientExpiresAt,omitzero"`
+	ExpiresAt       time.Time `json:"ExpiresAt,omitzero"`
+
+	ClientID     string `json:"ClientId,omitempty"`
+	ClientSecret string `json:"ClientSecret,omitempty"`
+	AccessToken  string `json:"AccessToken,omitempty"`
+	RefreshToken string `json:"RefreshToken,omitempty"`
+}
+
+const (
+	ssoService          = keyringService + "-sso"
+	ssoScope            = "sso:account:access"
+	grantDeviceCode     = "urn:ietf:params:oauth:grant-type:device_code"
+	grantRefreshToken   = "refresh_token"
+	defaultPollInterval = 5 * time.Second
+)
+
+func (c *Creds) isSSO() bool {
+	return c.SsoStartURL != ""
+}
+
+func (t *ssoToken) load(st Store, startURL string) (err error) {
+	raw, err := st.Get(ssoService, startURL)
+	if err != nil {
+		return
+	}
+
+	return json.Unmarshal([]byte(raw), t)
+}
+
+func (t *ssoToken) store(st Store, startURL string) (err error) {
+	b, err := json.Marshal(*t)
+	if err != nil {
+		return
+	}
+
+	return st.Set(ssoService, startURL, string(b))
+}
+
+func (t *ssoToken) clientValid(now time.Time) bool {
+	return t.ClientID != "" && now.Before(t.ClientExpiresAt)
+}
+
+func (t *ssoToken) setToken(out *ssooidc.CreateTokenOutput, now time.Time) {
+	t.AccessToken = aws.ToString(out.AccessToken)
+	t.RefreshToken = cmp.Or(aws.ToString(out.RefreshToken), t.RefreshToken)
+	t.ExpiresAt = now.Add(time.Duration(out.ExpiresIn) * time.Second)
+}
+
+func (a *app) ssoRoleCredentials(ctx context.Context, target *Creds) (c Creds, err error) {
+	c = *target
+	region := cmp.Or(c.SsoRegion, a.AWSRegion)
+
+	token, err := a.ssoAccessToken(ctx, c.SsoStartURL, region, c.SkewPad)
+	if err != nil {
+		return c, fmt.Errorf("sso %s: %w", c.SsoStartURL, err)
+	}
+
+	out, err := a.mkSSOClient(region).GetRoleCredentials(ctx, &sso.GetRoleCredentialsInput{
+		AccessToken: &token,
+		AccountId:   &c.SsoAccountID,
+		RoleName:    &c.SsoRoleName,
+	})
+	if err != nil {
+		return c, fmt.Errorf("sso get-role-credentials %s/%s: %w", c.SsoAccountID, c.SsoRoleName, err)
+	}
+
+	if out.RoleCredentials == nil {
+		return c, errors.New("sso get-role-credentials: empty credentials")
+	}
+
+	c.AccessKeyID = aws.ToString(out.RoleCredentials.AccessKeyId)
+	c.SecretAccessKey = aws.ToString(out.RoleCredentials.SecretAccessKey)
+	c.SessionToken = aws.ToString(out.RoleCredentials.SessionToken)
+	c.Expiration = time.UnixMilli(out.RoleCredentials.Expiration)
+
+	return c, nil
+}
+
+// ssoAccessToken returns a valid SSO access token, using (in order) the
+// cached one, a refresh token or a new device authorization.
+func (a *app) ssoAccessToken(ctx context.Context, startURL, region string, skewPad time.Duration) (string, error) {
+	var token ssoToken
+
+	if err := token.load(a.store, startURL); err != nil && !errors.Is(err, errNotFound) {
+		return "", fmt.Errorf("load token: %w", err)
+	}
+
+	now := time.Now()
+	if token.AccessToken != "" && now.Add(skewPad).Before(token.ExpiresAt) {
+		return token.AccessToken, nil
+	}
+
+	oidc := a.mkSSOOIDCClient(region)
+
+	if token.RefreshToken != "" && token.clientValid(now) {
+		out, err := oidc.CreateToken(ctx, &ssooidc.CreateTokenInput{
+			ClientId:     &token.ClientID,
+			ClientSecret: &token.ClientSecret,
+			GrantType:    p(grantRefreshToken),
+			RefreshToken: &token.RefreshToken,
+		})
+		if err == nil {
+			token.setToken(out, now)
+			return token.AccessToken, token.store(a.store, startURL)
+		}
+	}
+
+	if err := a.ssoDeviceAuthorization(ctx, oidc, startURL, &token); err != nil {
+		return "", err
+	}
+
+	return token.AccessToken, token.store(a.store, startURL)
+}
+
+func (t *ssoToken) registerClient(ctx context.Context, oidc ssoOIDCAPI) (err error) {
+	reg, err := oidc.RegisterClient(ctx, &ssooidc.RegisterClientInput{
+		ClientName: p(keyringService),
+		ClientType: p("public"),
+		GrantTypes: []string{grantDeviceCode, grantRefreshToken},
+		Scopes:     []string{ssoScope},
+	})
+	if err != nil {
+		return fmt.Errorf("register client: %w", err)
+	}
+
+	t.ClientID = aws.ToString(reg.ClientId)
+	t.ClientSecret = aws.ToString(reg.ClientSecret)
+	t.ClientExpiresAt = time.Unix(reg.ClientSecretExpiresAt, 0)
+
+	return
+}
+
+// ssoDeviceAuthorization runs the OIDC device authorization flow, polling
+// CreateToken until the user approves the request in the browser.
+func (a *app) ssoDeviceAuthorization(ctx context.Context, oidc ssoOIDCAPI, startURL string, tok *ssoToken) (err error) {
+	if !tok.clientValid(time.Now()) {
+		if err = tok.registerClient(ctx, oidc); err != nil {
+			return
+		}
+	}
+
+	auth, err := oidc.StartDeviceAuthorization(ctx, &ssooidc.StartDeviceAuthorizationInput{
+		ClientId:     &tok.ClientID,
+		ClientSecret: &tok.ClientSecret,
+		StartUrl:     &startURL,
+	})
+	if err != nil {
+		return fmt.Errorf("start device authorization: %w", err)
+	}
+
+	// Stdout is reserved for the credential_process output.
+	fmt.Fprintf(os.Stderr, "Open %s and confirm the code %s to sign in to %s\n",
+		aws.ToString(auth.VerificationUriComplete), aws.ToString(auth.UserCode), startURL)
+
+	interval := cmp.Or(time.Duration(auth.Interval)*time.Second, defaultPollInterval)
+	deadline := time.Now().Add(time.Duration(auth.ExpiresIn) * time.Second)
+
+	for {
+		now := time.Now()
+
+		out, cerr := oidc.CreateToken(ctx, &ssooidc.CreateTokenInput{
+			ClientId:     &tok.ClientID,
+			ClientSecret: &tok.ClientSecret,
+			GrantType:    p(grantDeviceCode),
+			DeviceCode:   auth.DeviceCode,
+		})
+		if cerr == nil {
+			tok.setToken(out, now)
+			return nil
+		}
+
+		var (
+			pending *ssooidctypes.AuthorizationPendingException
+			slow    *ssooidctypes.SlowDownException
+		)
+
+		switch {
+		case errors.As(cerr, &slow):
+			interval += defaultPollInterval
+		case !errors.As(cerr, &pending):
+			return fmt.Errorf("create token: %w", cerr)
+		}
+
+		if now.Add(interval).After(deadline) {
+			return errors.New("device authorization expired")
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (a *app) promptSSO(c *Creds) (err error) {
+	if err = a.prompt("SsoStartUrl", &c.SsoStartURL); err != nil {
+		return
+	}
+
+	a.promptOptional("SsoRegion (press Enter for AWS_REGION)", &c.SsoRegion)
+
+	if err = a.prompt("SsoAccountId", &c.SsoAccountID); err != nil {
+		return
+	}
+
+	return a.prompt("SsoRoleName", &c.SsoRoleName)
+}
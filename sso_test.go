@@ -0,0 +1,324 @@
+//nolint:lll // ok
+package main
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sso"
+	ssotypes "github.com/aws/aws-sdk-go-v2/service/sso/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	ssooidctypes "github.com/aws/aws-sdk-go-v2/service/ssooidc/types"
+	"github.com/zalando/go-keyring"
+)
+
+type mockSSOOIDCClient struct {
+	registerClientFunc func(context.Context, *ssooidc.RegisterClientInput, ...func(*ssooidc.Options)) (*ssooidc.RegisterClientOutput, error)
+	startDeviceFunc    func(context.Context, *ssooidc.StartDeviceAuthorizationInput, ...func(*ssooidc.Options)) (*ssooidc.StartDeviceAuthorizationOutput, error)
+	createTokenFunc    func(context.Context, *ssooidc.CreateTokenInput, ...func(*ssooidc.Options)) (*ssooidc.CreateTokenOutput, error)
+}
+
+type mockSSOClient struct {
+	getRoleCredentialsFunc func(context.Context, *sso.GetRoleCredentialsInput, ...func(*sso.Options)) (*sso.GetRoleCredentialsOutput, error)
+}
+
+const testStartURL = "https://example.awsapps.com/start"
+
+func (m *mockSSOOIDCClient) RegisterClient(ctx context.Context, input *ssooidc.RegisterClientInput, opts ...func(*ssooidc.Options)) (*ssooidc.RegisterClientOutput, error) {
+	return m.registerClientFunc(ctx, input, opts...)
+}
+
+func (m *mockSSOOIDCClient) StartDeviceAuthorization(ctx context.Context, input *ssooidc.StartDeviceAuthorizationInput, opts ...func(*ssooidc.Options)) (*ssooidc.StartDeviceAuthorizationOutput, error) {
+	return m.startDeviceFunc(ctx, input, opts...)
+}
+
+func (m *mockSSOOIDCClient) CreateToken(ctx context.Context, input *ssooidc.CreateTokenInput, opts ...func(*ssooidc.Options)) (*ssooidc.CreateTokenOutput, error) {
+	return m.createTokenFunc(ctx, input, opts...)
+}
+
+func (m *mockSSOClient) GetRoleCredentials(ctx context.Context, input *sso.GetRoleCredentialsInput, opts ...func(*sso.Options)) (*sso.GetRoleCredentialsOutput, error) {
+	return m.getRoleCredentialsFunc(ctx, input, opts...)
+}
+
+func newMockSSOOIDC(createTokenFn func(context.Context, *ssooidc.CreateTokenInput, ...func(*ssooidc.Options)) (*ssooidc.CreateTokenOutput, error), expiresIn int32) *mockSSOOIDCClient {
+	return &mockSSOOIDCClient{
+		registerClientFunc: func(ctx context.Context, input *ssooidc.RegisterClientInput, opts ...func(*ssooidc.Options)) (*ssooidc.RegisterClientOutput, error) {
+			return &ssooidc.RegisterClientOutput{
+				ClientId:              aws.String("new-client"),
+				ClientSecret:          aws.String("new-secret"),
+				ClientSecretExpiresAt: time.Now().Add(90 * 24 * time.Hour).Unix(),
+			}, nil
+		},
+		startDeviceFunc: func(ctx context.Context, input *ssooidc.StartDeviceAuthorizationInput, opts ...func(*ssooidc.Options)) (*ssooidc.StartDeviceAuthorizationOutput, error) {
+			if aws.ToString(input.StartUrl) != testStartURL || aws.ToString(input.ClientId) != "new-client" {
+				return nil, errors.New("bad input")
+			}
+
+			return &ssooidc.StartDeviceAuthorizationOutput{
+				DeviceCode:              aws.String("device"),
+				UserCode:                aws.String("ABCD-EFGH"),
+				VerificationUriComplete: aws.String(testStartURL + "/#/device?user_code=ABCD-EFGH"),
+				ExpiresIn:               expiresIn,
+			}, nil
+		},
+		createTokenFunc: createTokenFn,
+	}
+}
+
+func newMockSSO(wantAccessToken string) *mockSSOClient {
+	return &mockSSOClient{
+		getRoleCredentialsFunc: func(ctx context.Context, input *sso.GetRoleCredentialsInput, opts ...func(*sso.Options)) (*sso.GetRoleCredentialsOutput, error) {
+			if aws.ToString(input.AccessToken) != wantAccessToken || aws.ToString(input.AccountId) != "123" || aws.ToString(input.RoleName) != "Admin" {
+				return nil, errors.New("bad input")
+			}
+
+			return &sso.GetRoleCredentialsOutput{RoleCredentials: &ssotypes.RoleCredentials{
+				AccessKeyId:     aws.String("ASIASSO"),
+				SecretAccessKey: aws.String("tempsecret"),
+				SessionToken:    aws.String("token"),
+				Expiration:      time.Now().Add(time.Hour).UnixMilli(),
+			}}, nil
+		},
+	}
+}
+
+func TestAppSSORoleCredentials(t *testing.T) { //nolint:funlen // ok
+	profile := Creds{Version: 1, SsoStartURL: testStartURL, SsoRegion: "eu-west-1", SsoAccountID: "123", SsoRoleName: "Admin"}
+	profileJSON, _ := json.Marshal(profile) //nolint:errcheck // ok
+	validClient := ssoToken{ClientID: "old-client", ClientSecret: "old-secret", ClientExpiresAt: time.Now().Add(time.Hour)}
+	deviceToken := func(_ context.Context, input *ssooidc.CreateTokenInput, _ ...func(*ssooidc.Options)) (*ssooidc.CreateTokenOutput, error) {
+		if aws.ToString(input.GrantType) != grantDeviceCode || aws.ToString(input.DeviceCode) != "device" {
+			return nil, errors.New("bad grant")
+		}
+
+		return &ssooidc.CreateTokenOutput{AccessToken: aws.String("access"), RefreshToken: aws.String("refresh"), ExpiresIn: 3600}, nil
+	}
+	tests := []struct {
+		cached          *ssoToken
+		oidc            *mockSSOOIDCClient
+		name            string
+		wantAccessToken string
+		wantErr         bool
+	}{
+		{
+			name: "cached access token",
+			cached: &ssoToken{
+				ClientID: "old-client", ClientSecret: "old-secret", ClientExpiresAt: time.Now().Add(time.Hour),
+				AccessToken: "access", ExpiresAt: time.Now().Add(time.Hour),
+			},
+			oidc:            &mockSSOOIDCClient{},
+			wantAccessToken: "access",
+		},
+		{
+			name: "refresh token",
+			cached: &ssoToken{
+				ClientID: "old-client", ClientSecret: "old-secret", ClientExpiresAt: time.Now().Add(time.Hour),
+				AccessToken: "stale", RefreshToken: "refresh", ExpiresAt: time.Now().Add(-time.Minute),
+			},
+			oidc: &mockSSOOIDCClient{
+				createTokenFunc: func(ctx context.Context, input *ssooidc.CreateTokenInput, opts ...func(*ssooidc.Options)) (*ssooidc.CreateTokenOutput, error) {
+					if aws.ToString(input.GrantType) != grantRefreshToken || aws.ToString(input.RefreshToken) != "refresh" {
+						return nil, errors.New("bad grant")
+					}
+
+					return &ssooidc.CreateTokenOutput{AccessToken: aws.String("access"), ExpiresIn: 3600}, nil
+				},
+			},
+			wantAccessToken: "access",
+		},
+		{
+			name:            "device authorization",
+			oidc:            newMockSSOOIDC(deviceToken, 600),
+			wantAccessToken: "access",
+		},
+		{
+			name: "device authorization after failed refresh",
+			cached: &ssoToken{
+				ClientID: "new-client", ClientSecret: "new-secret", ClientExpiresAt: time.Now().Add(time.Hour),
+				RefreshToken: "revoked",
+			},
+			oidc: newMockSSOOIDC(func(ctx context.Context, input *ssooidc.CreateTokenInput, opts ...func(*ssooidc.Options)) (*ssooidc.CreateTokenOutput, error) {
+				if aws.ToString(input.GrantType) == grantRefreshToken {
+					return nil, &ssooidctypes.InvalidGrantException{}
+				}
+
+				return deviceToken(ctx, input, opts...)
+			}, 600),
+			wantAccessToken: "access",
+		},
+		{
+			name: "authorization pending until expiry",
+			oidc: newMockSSOOIDC(func(ctx context.Context, input *ssooidc.CreateTokenInput, opts ...func(*ssooidc.Options)) (*ssooidc.CreateTokenOutput, error) {
+				return nil, &ssooidctypes.AuthorizationPendingException{}
+			}, 0),
+			wantErr: true,
+		},
+		{
+			name: "slow down until expiry",
+			oidc: newMockSSOOIDC(func(ctx context.Context, input *ssooidc.CreateTokenInput, opts ...func(*ssooidc.Options)) (*ssooidc.CreateTokenOutput, error) {
+				return nil, &ssooidctypes.SlowDownException{}
+			}, 5),
+			wantErr: true,
+		},
+		{
+			name: "access denied",
+			oidc: newMockSSOOIDC(func(ctx context.Context, input *ssooidc.CreateTokenInput, opts ...func(*ssooidc.Options)) (*ssooidc.CreateTokenOutput, error) {
+				return nil, &ssooidctypes.AccessDeniedException{}
+			}, 600),
+			wantErr: true,
+		},
+		{
+			name: "register client error",
+			oidc: &mockSSOOIDCClient{
+				registerClientFunc: func(ctx context.Context, input *ssooidc.RegisterClientInput, opts ...func(*ssooidc.Options)) (*ssooidc.RegisterClientOutput, error) {
+					return nil, errors.New("register failed")
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name:   "start device authorization error",
+			cached: &validClient,
+			oidc: &mockSSOOIDCClient{
+				startDeviceFunc: func(ctx context.Context, input *ssooidc.StartDeviceAuthorizationInput, opts ...func(*ssooidc.Options)) (*ssooidc.StartDeviceAuthorizationOutput, error) {
+					return nil, errors.New("start failed")
+				},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+			keyring.Set(keyringService, "sso", string(profileJSON)) //nolint:errcheck,gosec // ok
+
+			if tt.cached != nil {
+				tt.cached.store(keyringStore{}, testStartURL) //nolint:errcheck,gosec // ok
+			}
+
+			a := app{
+				store:  keyringStore{},
+				config: config{AWSRegion: "us-east-1", SkewPad: 2 * time.Minute, SessionTTL: time.Hour},
+				mkSSOOIDCClient: func(region string) ssoOIDCAPI {
+					if region != "eu-west-1" {
+						t.Errorf("OIDC region = %s, want eu-west-1", region)
+					}
+
+					return tt.oidc
+				},
+				mkSSOClient: func(string) ssoAPI { return newMockSSO(tt.wantAccessToken) },
+			}
+
+			got, err := a.resolveAndMaybeRefresh(t.Context(), "sso")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveAndMaybeRefresh() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if got.AccessKeyID != "ASIASSO" || !got.credsFresh(time.Now()) {
+				t.Errorf("resolveAndMaybeRefresh() = %+v", got)
+			}
+
+			checkSSOPersisted(t, tt.wantAccessToken)
+		})
+	}
+}
+
+func checkSSOPersisted(t *testing.T, wantAccessToken string) {
+	t.Helper()
+
+	var token ssoToken
+	if err := token.load(keyringStore{}, testStartURL); err != nil || token.AccessToken != wantAccessToken {
+		t.Errorf("stored token = %+v, %v", token, err)
+	}
+
+	var stored, session Creds
+	if err := stored.load(keyringStore{}, "sso"); err != nil || stored.AccessKeyID != "" || stored.SsoRoleName != "Admin" {
+		t.Errorf("persisted profile = %+v, %v", stored, err)
+	}
+
+	if err := session.loadSession(keyringStore{}, "sso"); err != nil || session.AccessKeyID != "ASIASSO" || session.SsoRoleName != "" {
+		t.Errorf("persisted session = %+v, %v", session, err)
+	}
+}
+
+func TestAppSSODeviceAuthorizationCancelled(t *testing.T) {
+	keyring.MockInit()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	a := app{store: keyringStore{}}
+	oidc := newMockSSOOIDC(func(ctx context.Context, input *ssooidc.CreateTokenInput, opts ...func(*ssooidc.Options)) (*ssooidc.CreateTokenOutput, error) {
+		cancel()
+		return nil, &ssooidctypes.AuthorizationPendingException{}
+	}, 600)
+
+	var token ssoToken
+	if err := a.ssoDeviceAuthorization(ctx, oidc, testStartURL, &token); !errors.Is(err, context.Canceled) {
+		t.Errorf("ssoDeviceAuthorization() error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestAppRunStoreSSO(t *testing.T) {
+	tests := []struct {
+		mockPrompt func(string, *string) error
+		name       string
+		wantErr    bool
+	}{
+		{
+			name: "all fields",
+			mockPrompt: func(label string, val *string) error {
+				switch label {
+				case "SsoStartUrl":
+					*val = testStartURL
+				case "SsoAccountId":
+					*val = "123"
+				case "SsoRoleName":
+					*val = "Admin"
+				default:
+					return errors.New("skipped")
+				}
+
+				return nil
+			},
+		},
+		{
+			name: "missing role name",
+			mockPrompt: func(label string, val *string) error {
+				if label == "SsoRoleName" {
+					return errors.New("skipped")
+				}
+
+				*val = "x"
+
+				return nil
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+
+			a := app{store: keyringStore{}, config: config{AWSProfile: "sso"}, prompt: tt.mockPrompt}
+
+			err := a.run(t.Context(), []string{"awbus", "store-sso"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var c Creds
+			if err == nil && (c.load(keyringStore{}, "sso") != nil || !c.isSSO() || c.isStatic() || c.SsoRoleName != "Admin") {
+				t.Errorf("stored profile = %+v", c)
+			}
+		})
+	}
+}
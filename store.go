@@ -0,0 +1,165 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+// Store is a secret storage backend. Secrets are addressed by service and
+// username, as in the OS keyring.
+type Store interface {
+	Get(service, username string) (string, error)
+	Set(service, username, secret string) error
+	Delete(service, username string) error
+	List(service string) ([]string, error)
+}
+
+// keyringStore is the OS keyring backend. The keyring has no enumerate call,
+// so it keeps the usernames of the services awbus lists in an index entry for
+// List, updated under a lock file in lockDir (none if empty). Its services
+// may be renamed (see renamedStore) after name.
+type keyringStore struct {
+	name    string
+	lockDir string
+}
+
+const (
+	backendKeyring   = "keyring"
+	indexService     = keyringService + "-index"
+	indexLockName    = "index.lock"
+	indexLockTimeout = 10 * time.Second
+)
+
+var errNotFound = errors.New("secret not found in store")
+
+// newStore opens the backend, making its changes visible to a running agent.
+func (a *app) newStore(backend string) (Store, error) { //nolint:ireturn // Selected at runtime.
+	st, err := a.newBackend(backend)
+	if err != nil {
+		return nil, err
+	}
+
+	return a.stampStore(st), nil
+}
+
+func (a *app) newBackend(backend string) (Store, error) { //nolint:ireturn // Selected at runtime.
+	switch backend {
+	case "", backendKeyring:
+		return keyringStore{lockDir: a.lockDir}, nil
+	case backendFile:
+		// The passphrase prompt must not use stdout (credential_process).
+		return newFileStore(&a.config, a.ttySecret)
+	case backendKeepass:
+		return newKeepassStore(&a.config, a.ttySecret)
+	case backendVault:
+		return newVaultStore(&a.config, &http.Client{Timeout: vaultTimeout}), nil
+	case backendPass:
+		return newPassStore(&a.config)
+	default:
+		return nil, fmt.Errorf("unknown backend %q", backend)
+	}
+}
+
+func (keyringStore) Get(service, username string) (string, error) {
+	secret, err := keyring.Get(service, username)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", fmt.Errorf("%s/%s: %w", service, username, errNotFound)
+	}
+
+	return secret, err
+}
+
+func (ks keyringStore) Set(service, username, secret string) (err error) {
+	if err = keyring.Set(service, username, secret); err != nil {
+		return
+	}
+
+	return ks.updateIndex(service, func(names []string) []string {
+		if slices.Contains(names, username) {
+			return names
+		}
+
+		return append(names, username)
+	})
+}
+
+func (ks keyringStore) Delete(service, username string) (err error) {
+	if err = keyring.Delete(service, username); errors.Is(err, keyring.ErrNotFound) {
+		return fmt.Errorf("%s/%s: %w", service, username, errNotFound)
+	} else if err != nil {
+		return
+	}
+
+	return ks.updateIndex(service, func(names []string) []string {
+		return slices.DeleteFunc(names, func(n string) bool { return n == username })
+	})
+}
+
+func (keyringStore) List(service string) (names []string, err error) {
+	raw, err := keyring.Get(indexService, service)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+
+	err = json.Unmarshal([]byte(raw), &names)
+
+	return
+}
+
+// updateIndex updates the index of service, if one awbus lists (profiles,
+// sessions and SSO tokens; not e.g. put secrets), under the index lock:
+// concurrent awbus processes (e.g. credential_process calls storing
+// sessions) must not drop each other's names.
+func (ks keyringStore) updateIndex(service string, update func(names []string) []string) (err error) {
+	renamed := renamedStore{name: cmp.Or(ks.name, keyringService)}
+	listed := []string{keyringService, sessionService, ssoService}
+
+	if !slices.ContainsFunc(listed, func(s string) bool { return renamed.rename(s) == service }) {
+		return
+	}
+
+	if ks.lockDir != "" {
+		if err = os.MkdirAll(ks.lockDir, privateDirMode); err != nil {
+			return fmt.Errorf("index lock: %w", err)
+		}
+
+		unlock, lerr := lockFile(filepath.Join(ks.lockDir, indexLockName), indexLockTimeout)
+		if lerr != nil {
+			return fmt.Errorf("index lock: %w", lerr)
+		}
+		defer unlock()
+	}
+
+	names, err := ks.List(service)
+	if err != nil {
+		return
+	}
+
+	if updated := update(slices.Clone(names)); len(updated) != len(names) {
+		err = ks.setIndex(service, updated)
+	}
+
+	return
+}
+
+func (keyringStore) setIndex(service string, names []string) error {
+	slices.Sort(names)
+
+	b, err := json.Marshal(names)
+	if err != nil {
+		return err
+	}
+
+	return keyring.Set(indexService, service, string(b))
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/zalando/go-keyring"
+)
+
+func TestNewStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		backend string
+		wantErr bool
+	}{
+		{name: "default", backend: ""},
+		{name: "keyring", backend: "keyring"},
+		{name: "file", backend: "file"},
+		{name: "pass", backend: "pass"},
+		{name: "keepass", backend: "keepass"},
+		{name: "vault", backend: "vault"},
+		{name: "unknown", backend: "floppy", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := app{config: config{AwbusFile: "secrets.enc", AwbusKeepassFile: "awbus.kdbx"}}
+
+			st, err := a.newStore(tt.backend)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !tt.wantErr && st == nil {
+				t.Error("newStore() returned nil store")
+			}
+		})
+	}
+}
+
+func TestKeyringStoreGet(t *testing.T) {
+	tests := []struct {
+		setupFn      func()
+		name         string
+		username     string
+		wantVal      string
+		wantNotFound bool
+	}{
+		{
+			name:     "existing key",
+			username: "test-profile",
+			setupFn: func() {
+				keyring.Set(keyringService, "test-profile", "test-value") //nolint:errcheck,gosec // ok
+			},
+			wantVal: "test-value",
+		},
+		{
+			name:         "nonexistent key",
+			username:     "nonexistent",
+			setupFn:      func() {},
+			wantNotFound: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+			tt.setupFn()
+
+			got, err := keyringStore{}.Get(keyringService, tt.username)
+			if errors.Is(err, errNotFound) != tt.wantNotFound {
+				t.Fatalf("Get() error = %v, wantNotFound %v", err, tt.wantNotFound)
+			}
+
+			if got != tt.wantVal {
+				t.Errorf("Get() = %s, want %s", got, tt.wantVal)
+			}
+		})
+	}
+}
+
+func TestKeyringStoreSetDeleteList(t *testing.T) {
+	keyring.MockInit()
+
+	st := keyringStore{}
+
+	for _, name := range []string{"b", "a", "b", "c"} {
+		if err := st.Set(keyringService, name, "value-"+name); err != nil {
+			t.Fatalf("Set(%s) error = %v", name, err)
+		}
+	}
+
+	if err := st.Set("other", "x", "value"); err != nil {
+		t.Fatalf("Set(other) error = %v", err)
+	}
+
+	if got, err := st.Get(keyringService, "b"); err != nil || got != "value-b" {
+		t.Errorf("Get() = %s, %v", got, err)
+	}
+
+	if got, err := st.List(keyringService); err != nil || !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Errorf("List() = %v, %v", got, err)
+	}
+
+	if err := st.Delete(keyringService, "b"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if err := st.Delete(keyringService, "b"); !errors.Is(err, errNotFound) {
+		t.Errorf("Delete() twice error = %v, want %v", err, errNotFound)
+	}
+
+	if _, err := st.Get(keyringService, "b"); !errors.Is(err, errNotFound) {
+		t.Errorf("Get() after Delete() error = %v, want %v", err, errNotFound)
+	}
+
+	if got, err := st.List(keyringService); err != nil || !slices.Equal(got, []string{"a", "c"}) {
+		t.Errorf("List() after Delete() = %v, %v", got, err)
+	}
+
+	if got, err := st.List("empty"); err != nil || len(got) != 0 {
+		t.Errorf("List(empty) = %v, %v", got, err)
+	}
+
+	if _, err := keyring.Get(indexService, "other"); !errors.Is(err, keyring.ErrNotFound) {
+		t.Errorf("index of other error = %v, want not indexed", err)
+	}
+}
+
+func TestKeyringStoreIndexLock(t *testing.T) {
+	keyring.MockInit()
+
+	st := keyringStore{lockDir: t.TempDir()}
+
+	unlock, err := lockFile(filepath.Join(st.lockDir, indexLockName), time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+
+	go func() { done <- st.Set(sessionService, "dev", "{}") }()
+
+	select {
+	case err = <-done:
+		t.Fatalf("Set() with the index locked = %v, want it to wait", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	unlock()
+
+	if err = <-done; err != nil {
+		t.Fatalf("Set() error = %v", err)
+	}
+
+	if got, lerr := st.List(sessionService); lerr != nil || !slices.Equal(got, []string{"dev"}) {
+		t.Errorf("List() = %v, %v", got, lerr)
+	}
+}
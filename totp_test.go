@@ -0,0 +1,228 @@
+//nolint:lll // ok
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/zalando/go-keyring"
+)
+
+const (
+	rfcSeedSHA1   = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	rfcSeedSHA256 = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZA"
+	rfcSeedSHA512 = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNA"
+)
+
+func TestTOTPCode(t *testing.T) {
+	tests := []struct {
+		name    string
+		seed    string
+		want    string
+		unix    int64
+		wantErr bool
+	}{
+		{name: "RFC 6238 SHA1 59", seed: "otpauth://totp/x?digits=8&secret=" + rfcSeedSHA1, unix: 59, want: "94287082"},
+		{name: "RFC 6238 SHA1 1111111109", seed: "otpauth://totp/x?digits=8&secret=" + rfcSeedSHA1, unix: 1111111109, want: "07081804"},
+		{name: "RFC 6238 SHA1 2000000000", seed: "otpauth://totp/x?digits=8&secret=" + rfcSeedSHA1, unix: 2000000000, want: "69279037"},
+		{name: "RFC 6238 SHA256 59", seed: "otpauth://totp/x?digits=8&algorithm=SHA256&secret=" + rfcSeedSHA256, unix: 59, want: "46119246"},
+		{name: "RFC 6238 SHA256 1111111109", seed: "otpauth://totp/x?digits=8&algorithm=SHA256&secret=" + rfcSeedSHA256, unix: 1111111109, want: "68084774"},
+		{name: "RFC 6238 SHA512 59", seed: "otpauth://totp/x?digits=8&algorithm=SHA512&secret=" + rfcSeedSHA512, unix: 59, want: "90693936"},
+		{name: "RFC 6238 SHA512 1111111109", seed: "otpauth://totp/x?digits=8&algorithm=SHA512&secret=" + rfcSeedSHA512, unix: 1111111109, want: "25091201"},
+		{name: "bare base32 secret", seed: rfcSeedSHA1, unix: 59, want: "287082"},
+		{name: "lowercase spaced secret", seed: " gezd gnbv gy3t qojq gezd gnbv gy3t qojq\n", unix: 59, want: "287082"},
+		{name: "custom period", seed: "otpauth://totp/x?period=60&secret=" + rfcSeedSHA1, unix: 118, want: "287082"},
+		{name: "empty secret", seed: "", wantErr: true},
+		{name: "invalid base32", seed: "not base32!", wantErr: true},
+		{name: "hotp not supported", seed: "otpauth://hotp/x?secret=" + rfcSeedSHA1, wantErr: true},
+		{name: "bad digits", seed: "otpauth://totp/x?digits=4&secret=" + rfcSeedSHA1, wantErr: true},
+		{name: "bad period", seed: "otpauth://totp/x?period=-1&secret=" + rfcSeedSHA1, wantErr: true},
+		{name: "bad algorithm", seed: "otpauth://totp/x?algorithm=MD5&secret=" + rfcSeedSHA1, wantErr: true},
+		{name: "missing URI secret", seed: "otpauth://totp/x", wantErr: true},
+		{name: "malformed URI", seed: "otpauth://%zz", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := totpCode(tt.seed, time.Unix(tt.unix, 0))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("totpCode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("totpCode() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppMfaCode(t *testing.T) {
+	tests := []struct {
+		setupFn   func()
+		ttyPrompt func(string, *string) error
+		name      string
+		creds     Creds
+		wantLen   int
+		wantErr   bool
+	}{
+		{
+			name:    "prompted code",
+			setupFn: func() {},
+			ttyPrompt: func(label string, val *string) error {
+				*val = "654321"
+				return nil
+			},
+			creds:   Creds{MfaSerial: "arn:aws:iam::123:mfa/user"},
+			wantLen: 6,
+		},
+		{
+			name: "generated code",
+			setupFn: func() {
+				keyring.Set(totpService, "seed", rfcSeedSHA1) //nolint:errcheck,gosec // ok
+			},
+			creds:   Creds{MfaSerial: "arn:aws:iam::123:mfa/user", MfaTotp: "seed"},
+			wantLen: 6,
+		},
+		{
+			name:    "missing seed",
+			setupFn: func() {},
+			creds:   Creds{MfaSerial: "arn:aws:iam::123:mfa/user", MfaTotp: "missing"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+			tt.setupFn()
+
+			a := app{store: keyringStore{}, ttyPrompt: tt.ttyPrompt}
+
+			got, err := a.mfaCode(&tt.creds)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mfaCode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if len(got) != tt.wantLen {
+				t.Errorf("mfaCode() = %q, want %d digits", got, tt.wantLen)
+			}
+		})
+	}
+}
+
+func TestAppAssumeRoleTOTP(t *testing.T) {
+	keyring.MockInit()
+	keyring.Set(totpService, "seed", rfcSeedSHA1) //nolint:errcheck,gosec // ok
+
+	want, _ := totpCode(rfcSeedSHA1, time.Now()) //nolint:errcheck // ok
+	a := app{
+		store: keyringStore{},
+		mkSTSClient: func(aws.CredentialsProvider) stsAPI {
+			return &mockSTSClient{
+				assumeRoleFunc: func(ctx context.Context, input *sts.AssumeRoleInput, opts ...func(*sts.Options)) (*sts.AssumeRoleOutput, error) {
+					if aws.ToString(input.TokenCode) != want {
+						return nil, errors.New("bad token code")
+					}
+
+					return &sts.AssumeRoleOutput{Credentials: &types.Credentials{AccessKeyId: aws.String("ASIATOTP")}}, nil
+				},
+			}
+		},
+	}
+	base := Creds{AccessKeyID: "AKIA123", SecretAccessKey: "secret123"}
+	target := Creds{RoleArn: "arn:aws:iam::123:role/test", MfaSerial: "arn:aws:iam::123:mfa/user", MfaTotp: "seed"}
+
+	got, err := a.assumeRole(t.Context(), "target", &base, &target)
+	if err != nil {
+		t.Fatalf("assumeRole() error = %v", err)
+	}
+
+	if got.AccessKeyID != "ASIATOTP" {
+		t.Errorf("AccessKeyID = %s, want ASIATOTP", got.AccessKeyID)
+	}
+}
+
+func TestAppRunTOTP(t *testing.T) { //nolint:funlen // ok
+	tests := []struct {
+		setupFn    func()
+		mockPrompt func(string, *string) error
+		name       string
+		args       []string
+		wantErr    bool
+	}{
+		{
+			name:    "put-totp",
+			args:    []string{"awbus", "put-totp", "seed"},
+			setupFn: func() {},
+			mockPrompt: func(label string, val *string) error {
+				*val = "otpauth://totp/AWS:me?secret=" + rfcSeedSHA1
+				return nil
+			},
+		},
+		{
+			name:    "put-totp invalid seed",
+			args:    []string{"awbus", "put-totp"},
+			setupFn: func() {},
+			mockPrompt: func(label string, val *string) error {
+				*val = "!!!"
+				return nil
+			},
+			wantErr: true,
+		},
+		{
+			name:    "put-totp prompt error",
+			args:    []string{"awbus", "put-totp"},
+			setupFn: func() {},
+			mockPrompt: func(label string, val *string) error {
+				return errors.New("prompt failed")
+			},
+			wantErr: true,
+		},
+		{
+			name: "totp",
+			args: []string{"awbus", "totp", totpService, "seed"},
+			setupFn: func() {
+				keyring.Set(totpService, "seed", rfcSeedSHA1) //nolint:errcheck,gosec // ok
+			},
+		},
+		{
+			name: "totp invalid seed",
+			args: []string{"awbus", "totp", "svc", "user"},
+			setupFn: func() {
+				keyring.Set("svc", "user", "not-a-seed!") //nolint:errcheck,gosec // ok
+			},
+			wantErr: true,
+		},
+		{
+			name:    "totp missing args",
+			args:    []string{"awbus", "totp", totpService},
+			setupFn: func() {},
+			wantErr: true,
+		},
+		{
+			name:    "totp nonexistent",
+			args:    []string{"awbus", "totp", totpService, "nonexistent"},
+			setupFn: func() {},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+			tt.setupFn()
+
+			a := app{store: keyringStore{}, config: config{AWSProfile: "default"}, prompt: tt.mockPrompt}
+
+			err := a.run(t.Context(), tt.args)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package main
+
+const (
+	ttyIn  = "/dev/tty"
+	ttyOut = "/dev/tty"
+)
@@ -0,0 +1,6 @@
+package main
+
+const (
+	ttyIn  = "CONIN$"
+	ttyOut = "CONOUT$"
+)
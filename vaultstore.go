@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// vaultStore keeps secrets in a HashiCorp Vault KV v2 mount, one secret per
+// service/username at <mount>/<path>/<service>/<username>, with the value
+// under the "value" key, so profiles are <mount>/awbus/awbus/<profile>. It
+// authenticates with VAULT_TOKEN (else ~/.vault-token) or, when a role ID is
+// set, logs in with AppRole.
+type vaultStore struct {
+	client    *http.Client
+	addr      string
+	token     string
+	namespace string
+	mount     string
+	path      string
+	roleID    string
+	secretID  string
+}
+
+// vaultResponse is the subset of the Vault API responses awbus reads.
+//
+//nolint:tagliatelle // Vault API.
+type vaultResponse struct {
+	Data struct {
+		Data *struct {
+			Value string `json:"value"`
+		} `json:"data"`
+		Keys []string `json:"keys"`
+	} `json:"data"`
+	Auth *struct {
+		ClientToken string `json:"client_token"`
+	} `json:"auth"`
+	Errors []string `json:"errors"`
+}
+
+const (
+	backendVault      = "vault"
+	defaultVaultAddr  = "https://127.0.0.1:8200"
+	defaultVaultMount = "secret"
+	vaultTimeout      = 30 * time.Second
+	vaultTokenFile    = ".vault-token"
+	vaultValueKey     = "value"
+)
+
+var errVaultNotFound = errors.New("vault: not found")
+
+func newVaultStore(cfg *config, client *http.Client) *vaultStore {
+	return &vaultStore{
+		client:    client,
+		addr:      strings.TrimSuffix(cmp.Or(cfg.VaultAddr, defaultVaultAddr), "/"),
+		token:     cfg.VaultToken,
+		namespace: cfg.VaultNamespace,
+		mount:     strings.Trim(cmp.Or(cfg.AwbusVaultMount, defaultVaultMount), "/"),
+		path:      strings.Trim(cmp.Or(cfg.AwbusVaultPath, keyringService), "/"),
+		roleID:    cfg.AwbusVaultRoleID,
+		secretID:  cfg.AwbusVaultSecretID,
+	}
+}
+
+func (s *vaultStore) Get(service, username string) (string, error) {
+	var resp vaultResponse
+
+	err := s.do(http.MethodGet, s.url("data", service, username), nil, &resp)
+	if errors.Is(err, errVaultNotFound) || (err == nil && resp.Data.Data == nil) {
+		return "", fmt.Errorf("%s/%s: %w", service, username, errNotFound)
+	} else if err != nil {
+		return "", err
+	}
+
+	return resp.Data.Data.Value, nil
+}
+
+func (s *vaultStore) Set(service, username, secret string) error {
+	body := map[string]any{"data": map[string]string{vaultValueKey: secret}}
+
+	return s.do(http.MethodPost, s.url("data", service, username), body, nil)
+}
+
+// Delete removes the secret with all its versions.
+func (s *vaultStore) Delete(service, username string) (err error) {
+	u := s.url("metadata", service, username)
+
+	if err = s.do(http.MethodGet, u, nil, nil); errors.Is(err, errVaultNotFound) {
+		return fmt.Errorf("%s/%s: %w", service, username, errNotFound)
+	} else if err != nil {
+		return
+	}
+
+	return s.do(http.MethodDelete, u, nil, nil)
+}
+
+func (s *vaultStore) List(service string) (names []string, err error) {
+	var resp vaultResponse
+
+	if err = s.do("LIST", s.url("metadata", service), nil, &resp); errors.Is(err, errVaultNotFound) {
+		return nil, nil
+	} else if err != nil {
+		return
+	}
+
+	for _, key := range resp.Data.Keys {
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+
+		if key, err = url.PathUnescape(key); err != nil {
+			return
+		}
+
+		names = append(names, key)
+	}
+
+	slices.Sort(names)
+
+	return
+}
+
+// url is the API URL of the KV v2 kind (data, metadata) endpoint for the
+// service (and username). Usernames may contain slashes (e.g. SSO start
+// URLs), so they are escaped.
+func (s *vaultStore) url(kind, service string, username ...string) string {
+	elems := slices.Concat([]string{"v1"}, strings.Split(s.mount, "/"), []string{kind},
+		strings.Split(s.path, "/"), strings.Split(service, "/"))
+	for _, u := range username {
+		elems = append(elems, url.PathEscape(u))
+	}
+
+	for i, e := range elems {
+		elems[i] = url.PathEscape(e)
+	}
+
+	u, _ := url.JoinPath(s.addr, elems...) //nolint:errcheck // Checked by do.
+
+	return u
+}
+
+func (s *vaultStore) do(method, u string, body, out any) (err error) {
+	if s.token == "" {
+		if err = s.login(); err != nil {
+			return
+		}
+	}
+
+	return s.request(method, u, s.token, body, out)
+}
+
+// login gets a token with AppRole or, failing that, from the token helper
+// file of the vault CLI.
+func (s *vaultStore) login() (err error) {
+	if s.roleID == "" {
+		home, herr := os.UserHomeDir()
+		if herr != nil {
+			return fmt.Errorf("vault: %w", herr)
+		}
+
+		raw, rerr := os.ReadFile(filepath.Join(home, vaultTokenFile)) //nolint:gosec // ok
+		if rerr != nil {
+			return errors.New("vault: no VAULT_TOKEN, ~/.vault-token or AWBUS_VAULT_ROLE_ID")
+		}
+
+		s.token = strings.TrimSpace(string(raw))
+
+		return nil
+	}
+
+	var resp vaultResponse
+
+	body := map[string]string{"role_id": s.roleID, "secret_id": s.secretID}
+	if err = s.request(http.MethodPost, s.addr+"/v1/auth/approle/login", "", body, &resp); err != nil {
+		return fmt.Errorf("approle login: %w", err)
+	}
+
+	if resp.Auth == nil || resp.Auth.ClientToken == "" {
+		return errors.New("vault: approle login returned no token")
+	}
+
+	s.token = resp.Auth.ClientToken
+
+	return nil
+}
+
+func (s *vaultStore) request(method, u, token string, body, out any) (err error) {
+	var rd io.Reader
+
+	if body != nil {
+		var raw []byte
+
+		if raw, err = json.Marshal(body); err != nil {
+			return
+		}
+
+		rd = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequestWithContext(context.Background(), method, u, rd)
+	if err != nil {
+		return
+	}
+
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+
+	if s.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.namespace)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close() //nolint:errcheck // ok
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return
+	}
+
+	return vaultDecode(resp.StatusCode, raw, out)
+}
+
+func vaultDecode(status int, raw []byte, out any) error {
+	var resp vaultResponse
+
+	if status >= http.StatusBadRequest {
+		json.Unmarshal(raw, &resp) //nolint:errcheck,gosec // Best effort, for the message.
+
+		if status == http.StatusNotFound && len(resp.Errors) == 0 {
+			return errVaultNotFound
+		}
+
+		return fmt.Errorf("vault: %d %s: %s", status, http.StatusText(status), strings.Join(resp.Errors, "; "))
+	}
+
+	if out == nil || len(raw) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(raw, out)
+}
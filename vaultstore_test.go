@@ -0,0 +1,198 @@
+package main
+
+import (
+	"encoding/json/v2"
+	"errors"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeVault is a KV v2 engine mounted at secret/ with AppRole login, enough
+// of the Vault API for vaultStore.
+type fakeVault struct {
+	secrets map[string]string
+	token   string
+	mu      sync.Mutex
+}
+
+func newFakeVault(t *testing.T) (*fakeVault, *httptest.Server) {
+	t.Helper()
+
+	fv := &fakeVault{secrets: map[string]string{}, token: "s.root"}
+	srv := httptest.NewServer(fv)
+	t.Cleanup(srv.Close)
+
+	return fv, srv
+}
+
+func (fv *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) { //nolint:varnamelen // ok
+	fv.mu.Lock()
+	defer fv.mu.Unlock()
+
+	if r.URL.Path == "/v1/auth/approle/login" {
+		var body map[string]string
+
+		if json.UnmarshalRead(r.Body, &body) != nil || body["role_id"] != "role" || body["secret_id"] != "secret" {
+			fv.reply(w, http.StatusBadRequest, map[string]any{"errors": []string{"invalid role or secret ID"}})
+			return
+		}
+
+		fv.reply(w, http.StatusOK, map[string]any{"auth": map[string]string{"client_token": fv.token}})
+
+		return
+	}
+
+	if r.Header.Get("X-Vault-Token") != fv.token {
+		fv.reply(w, http.StatusForbidden, map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+
+	if kind, path, ok := strings.Cut(strings.TrimPrefix(r.URL.Path, "/v1/secret/"), "/"); ok {
+		fv.kv(w, r, kind, path)
+		return
+	}
+
+	fv.reply(w, http.StatusNotFound, map[string]any{"errors": []string{}})
+}
+
+func (fv *fakeVault) kv(w http.ResponseWriter, r *http.Request, kind, path string) { //nolint:varnamelen // ok
+	secret, ok := fv.secrets[path]
+
+	switch method := r.Method; {
+	case method == http.MethodGet && ok:
+		fv.reply(w, http.StatusOK, map[string]any{"data": map[string]any{"data": map[string]string{"value": secret}}})
+	case method == http.MethodPost && kind == "data":
+		var body struct {
+			Data map[string]string `json:"data"` //nolint:tagliatelle // Vault API.
+		}
+
+		if json.UnmarshalRead(r.Body, &body) != nil {
+			fv.reply(w, http.StatusBadRequest, map[string]any{"errors": []string{"bad body"}})
+			return
+		}
+
+		fv.secrets[path] = body.Data["value"]
+
+		w.WriteHeader(http.StatusNoContent)
+	case method == http.MethodDelete && kind == "metadata":
+		delete(fv.secrets, path)
+		w.WriteHeader(http.StatusNoContent)
+	case method == "LIST":
+		var keys []string
+
+		for k := range maps.Keys(fv.secrets) {
+			if name, found := strings.CutPrefix(k, path+"/"); found {
+				keys = append(keys, strings.SplitAfter(name, "/")[0])
+			}
+		}
+
+		if len(keys) == 0 {
+			fv.reply(w, http.StatusNotFound, map[string]any{"errors": []string{}})
+			return
+		}
+
+		fv.reply(w, http.StatusOK, map[string]any{"data": map[string]any{"keys": keys}})
+	default:
+		fv.reply(w, http.StatusNotFound, map[string]any{"errors": []string{}})
+	}
+}
+
+func (fv *fakeVault) reply(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.MarshalWrite(w, body) //nolint:errcheck,gosec // ok
+}
+
+func TestVaultStore(t *testing.T) {
+	fv, srv := newFakeVault(t)
+	st := newVaultStore(&config{VaultAddr: srv.URL, VaultToken: "s.root"}, srv.Client())
+
+	if _, err := st.Get(keyringService, "p"); !errors.Is(err, errNotFound) {
+		t.Errorf("Get() missing error = %v, want %v", err, errNotFound)
+	}
+
+	for _, name := range []string{"b", "a", "https://x.awsapps.com/start"} {
+		if err := st.Set(keyringService, name, "value-"+name); err != nil {
+			t.Fatalf("Set(%s) error = %v", name, err)
+		}
+	}
+
+	if _, ok := fv.secrets["awbus/awbus/https:%2F%2Fx.awsapps.com%2Fstart"]; !ok {
+		t.Errorf("secrets = %v, want escaped username", slices.Sorted(maps.Keys(fv.secrets)))
+	}
+
+	if got, err := st.Get(keyringService, "https://x.awsapps.com/start"); err != nil ||
+		got != "value-https://x.awsapps.com/start" {
+		t.Errorf("Get() = %s, %v", got, err)
+	}
+
+	if got, err := st.List(keyringService); err != nil ||
+		!slices.Equal(got, []string{"a", "b", "https://x.awsapps.com/start"}) {
+		t.Errorf("List() = %v, %v", got, err)
+	}
+
+	if err := st.Delete(keyringService, "a"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+
+	if err := st.Delete(keyringService, "a"); !errors.Is(err, errNotFound) {
+		t.Errorf("Delete() twice error = %v, want %v", err, errNotFound)
+	}
+
+	if got, err := st.List("missing"); err != nil || len(got) != 0 {
+		t.Errorf("List(missing) = %v, %v", got, err)
+	}
+}
+
+func TestVaultStoreAuth(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	tests := []struct {
+		name      string
+		tokenFile string
+		wantErr   string
+		cfg       config
+	}{
+		{name: "token", cfg: config{VaultToken: "s.root"}},
+		{name: "bad token", cfg: config{VaultToken: "s.nope"}, wantErr: "403 Forbidden: permission denied"},
+		{name: "token file", tokenFile: "s.root\n"},
+		{name: "no token", wantErr: "no VAULT_TOKEN"},
+		{name: "approle", cfg: config{AwbusVaultRoleID: "role", AwbusVaultSecretID: "secret"}},
+		{
+			name:    "bad approle",
+			cfg:     config{AwbusVaultRoleID: "role", AwbusVaultSecretID: "guess"},
+			wantErr: "approle login: vault: 400 Bad Request: invalid role or secret ID",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, srv := newFakeVault(t)
+
+			tokenFile := filepath.Join(home, vaultTokenFile)
+			os.Remove(tokenFile) //nolint:errcheck,gosec // ok
+
+			if tt.tokenFile != "" {
+				os.WriteFile(tokenFile, []byte(tt.tokenFile), privateFileMode) //nolint:errcheck,gosec // ok
+			}
+
+			tt.cfg.VaultAddr = srv.URL + "/"
+
+			_, err := newVaultStore(&tt.cfg, srv.Client()).Get(keyringService, "p")
+			if tt.wantErr == "" && !errors.Is(err, errNotFound) {
+				t.Errorf("Get() error = %v, want %v", err, errNotFound)
+			} else if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Get() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+func (c *Creds) isWebIdentity() bool {
+	return c.RoleArn != "" && (c.WebIdentityTokenFile != "" ||
+		c.WebIdentityTokenKeyring != "" || c.WebIdentityTokenCommand != "")
+}
+
+// webIdentityToken reads the OIDC token from the profile's token source.
+func (c *Creds) webIdentityToken(ctx context.Context, st Store) (token string, err error) {
+	var raw []byte
+
+	switch {
+	case c.WebIdentityTokenFile != "":
+		raw, err = os.ReadFile(c.WebIdentityTokenFile)
+	case c.WebIdentityTokenKeyring != "":
+		service, username, ok := strings.Cut(c.WebIdentityTokenKeyring, "/")
+		if !ok {
+			return "", fmt.Errorf("invalid WebIdentityTokenKeyring %q, want service/username", c.WebIdentityTokenKeyring)
+		}
+
+		token, err = st.Get(service, username)
+		raw = []byte(token)
+	case c.WebIdentityTokenCommand != "":
+		args := strings.Fields(c.WebIdentityTokenCommand)
+		if len(args) == 0 {
+			return "", errors.New("empty WebIdentityTokenCommand")
+		}
+
+		raw, err = exec.CommandContext(ctx, args[0], args[1:]...).Output() //nolint:gosec // User configured.
+	default:
+		return "", errors.New("no web identity token source")
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("read web identity token: %w", err)
+	}
+
+	if token = strings.TrimSpace(string(raw)); token == "" {
+		return "", errors.New("empty web identity token")
+	}
+
+	return
+}
+
+func (a *app) assumeRoleWithWebIdentity(ctx context.Context, name string, target *Creds) (c Creds, err error) {
+	c = *target
+
+	token, err := c.webIdentityToken(ctx, a.store)
+	if err != nil {
+		return c, fmt.Errorf("assume-role-with-web-identity %s: %w", c.RoleArn, err)
+	}
+
+	sessionName, err := a.roleSessionName(name, &c)
+	if err != nil {
+		return c, fmt.Errorf("assume-role-with-web-identity %s: %w", c.RoleArn, err)
+	}
+
+	input := &sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          &c.RoleArn,
+		RoleSessionName:  &sessionName,
+		WebIdentityToken: &token,
+		DurationSeconds:  p(int32(c.SessionTTL.Seconds())),
+		Policy:           pNonZero(c.Policy),
+		PolicyArns:       c.policyArns(),
+	}
+
+	out, err := a.mkSTSClient(aws.AnonymousCredentials{}).AssumeRoleWithWebIdentity(ctx, input)
+	if err != nil {
+		return c, fmt.Errorf("assume-role-with-web-identity %s: %w", c.RoleArn, err)
+	}
+
+	if out.Credentials == nil {
+		return c, errors.New("assume-role-with-web-identity: empty credentials")
+	}
+
+	c.setSession(out.Credentials)
+
+	return c, nil
+}
+
+func (a *app) promptWebIdentity(c *Creds) (err error) {
+	if err = a.prompt("RoleArn", &c.RoleArn); err != nil {
+		return
+	}
+
+	a.promptOptional("WebIdentityTokenFile (press Enter to skip)", &c.WebIdentityTokenFile)
+
+	if c.WebIdentityTokenFile == "" {
+		a.promptOptional("WebIdentityTokenKeyring as service/username (press Enter to skip)", &c.WebIdentityTokenKeyring)
+	}
+
+	if c.WebIdentityTokenFile == "" && c.WebIdentityTokenKeyring == "" {
+		a.promptOptional("WebIdentityTokenCommand (press Enter to skip)", &c.WebIdentityTokenCommand)
+	}
+
+	if !c.isWebIdentity() {
+		return errors.New("web identity profile requires a token file, keyring entry or command")
+	}
+
+	a.promptOptional("RoleSessionName template (press Enter for default)", &c.RoleSessionName)
+
+	return checkSessionNameTemplate(c.RoleSessionName)
+}
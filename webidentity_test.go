@@ -0,0 +1,255 @@
+//nolint:lll // ok
+package main
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/aws/aws-sdk-go-v2/service/sts/types"
+	"github.com/zalando/go-keyring"
+)
+
+func TestCredsWebIdentityToken(t *testing.T) { //nolint:funlen // ok
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenFile, []byte("file-token\n"), 0o600) //nolint:errcheck,gosec // ok
+
+	emptyFile := filepath.Join(t.TempDir(), "empty")
+	os.WriteFile(emptyFile, nil, 0o600) //nolint:errcheck,gosec // ok
+
+	tests := []struct {
+		name    string
+		want    string
+		creds   Creds
+		wantErr bool
+	}{
+		{
+			name:  "file",
+			creds: Creds{WebIdentityTokenFile: tokenFile},
+			want:  "file-token",
+		},
+		{
+			name:  "keyring",
+			creds: Creds{WebIdentityTokenKeyring: "oidc/ci"},
+			want:  "keyring-token",
+		},
+		{
+			name:  "command",
+			creds: Creds{WebIdentityTokenCommand: "go env GOOS"},
+			want:  runtime.GOOS,
+		},
+		{
+			name:    "blank command",
+			creds:   Creds{WebIdentityTokenCommand: "  "},
+			wantErr: true,
+		},
+		{
+			name:    "missing file",
+			creds:   Creds{WebIdentityTokenFile: filepath.Join(t.TempDir(), "missing")},
+			wantErr: true,
+		},
+		{
+			name:    "empty file",
+			creds:   Creds{WebIdentityTokenFile: emptyFile},
+			wantErr: true,
+		},
+		{
+			name:    "malformed keyring reference",
+			creds:   Creds{WebIdentityTokenKeyring: "oidc"},
+			wantErr: true,
+		},
+		{
+			name:    "no source",
+			creds:   Creds{},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+			keyring.Set("oidc", "ci", "keyring-token") //nolint:errcheck,gosec // ok
+
+			got, err := tt.creds.webIdentityToken(t.Context(), keyringStore{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("webIdentityToken() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("webIdentityToken() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppAssumeRoleWithWebIdentity(t *testing.T) { //nolint:funlen // ok
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	os.WriteFile(tokenFile, []byte("jwt"), 0o600) //nolint:errcheck,gosec // ok
+
+	profile := Creds{Version: 1, RoleArn: "arn:aws:iam::123:role/ci", WebIdentityTokenFile: tokenFile}
+	profileJSON, _ := json.Marshal(profile) //nolint:errcheck // ok
+	tests := []struct {
+		mockFn    func(context.Context, *sts.AssumeRoleWithWebIdentityInput, ...func(*sts.Options)) (*sts.AssumeRoleWithWebIdentityOutput, error)
+		name      string
+		wantKeyID string
+		wantErr   bool
+	}{
+		{
+			name: "refreshed",
+			mockFn: func(ctx context.Context, input *sts.AssumeRoleWithWebIdentityInput, opts ...func(*sts.Options)) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+				if aws.ToString(input.WebIdentityToken) != "jwt" || aws.ToString(input.RoleSessionName) != "awbus-" {
+					return nil, errors.New("bad input")
+				}
+
+				return &sts.AssumeRoleWithWebIdentityOutput{Credentials: &types.Credentials{
+					AccessKeyId:     aws.String("ASIAWEB"),
+					SecretAccessKey: aws.String("tempsecret"),
+					SessionToken:    aws.String("token"),
+					Expiration:      aws.Time(time.Now().Add(time.Hour)),
+				}}, nil
+			},
+			wantKeyID: "ASIAWEB",
+		},
+		{
+			name: "STS error",
+			mockFn: func(ctx context.Context, input *sts.AssumeRoleWithWebIdentityInput, opts ...func(*sts.Options)) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+				return nil, errors.New("invalid identity token")
+			},
+			wantErr: true,
+		},
+		{
+			name: "nil credentials",
+			mockFn: func(ctx context.Context, input *sts.AssumeRoleWithWebIdentityInput, opts ...func(*sts.Options)) (*sts.AssumeRoleWithWebIdentityOutput, error) {
+				return &sts.AssumeRoleWithWebIdentityOutput{}, nil
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+			keyring.Set(keyringService, "ci", string(profileJSON)) //nolint:errcheck,gosec // ok
+
+			a := app{
+				store:  keyringStore{},
+				config: config{SkewPad: 2 * time.Minute, SessionTTL: time.Hour},
+				mkSTSClient: func(creds aws.CredentialsProvider) stsAPI {
+					if _, ok := creds.(aws.AnonymousCredentials); !ok {
+						t.Errorf("web identity STS client should be anonymous, got %T", creds)
+					}
+
+					return &mockSTSClient{assumeRoleWIFunc: tt.mockFn}
+				},
+			}
+
+			got, err := a.resolveAndMaybeRefresh(t.Context(), "ci")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveAndMaybeRefresh() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got.AccessKeyID != tt.wantKeyID {
+				t.Errorf("AccessKeyID = %s, want %s", got.AccessKeyID, tt.wantKeyID)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			var stored, session Creds
+			if err = stored.load(keyringStore{}, "ci"); err != nil || stored.AccessKeyID != "" || stored.WebIdentityTokenFile != tokenFile {
+				t.Errorf("persisted profile = %+v, %v", stored, err)
+			}
+
+			if err = session.loadSession(keyringStore{}, "ci"); err != nil || session.AccessKeyID != tt.wantKeyID {
+				t.Errorf("persisted session = %+v, %v", session, err)
+			}
+		})
+	}
+}
+
+func TestAppRunStoreWebIdentity(t *testing.T) { //nolint:funlen // ok
+	tests := []struct {
+		mockPrompt func(string, *string) error
+		name       string
+		wantErr    bool
+	}{
+		{
+			name: "command token source",
+			mockPrompt: func(label string, val *string) error {
+				switch label {
+				case "RoleArn":
+					*val = "arn:aws:iam::123:role/ci"
+				case "WebIdentityTokenCommand (press Enter to skip)":
+					*val = "gh auth token"
+				default:
+					return errors.New("skipped")
+				}
+
+				return nil
+			},
+		},
+		{
+			name: "no token source",
+			mockPrompt: func(label string, val *string) error {
+				if label == "RoleArn" {
+					*val = "arn:aws:iam::123:role/ci"
+					return nil
+				}
+
+				return errors.New("skipped")
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid RoleSessionName template",
+			mockPrompt: func(label string, val *string) error {
+				switch label {
+				case "RoleArn":
+					*val = "arn:aws:iam::123:role/ci"
+				case "WebIdentityTokenCommand (press Enter to skip)":
+					*val = "gh auth token"
+				case "RoleSessionName template (press Enter for default)":
+					*val = "ci/{profile}"
+				default:
+					return errors.New("skipped")
+				}
+
+				return nil
+			},
+			wantErr: true,
+		},
+		{
+			name: "prompt error",
+			mockPrompt: func(label string, val *string) error {
+				return errors.New("prompt failed")
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+
+			a := app{store: keyringStore{}, config: config{AWSProfile: "ci"}, prompt: tt.mockPrompt}
+
+			err := a.run(t.Context(), []string{"awbus", "store-web-identity"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var c Creds
+			if err == nil && (c.load(keyringStore{}, "ci") != nil || c.WebIdentityTokenCommand != "gh auth token") {
+				t.Errorf("stored profile = %+v", c)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+// callerIdentity is the sts:GetCallerIdentity result, as printed by whoami.
+type callerIdentity struct {
+	Account string `json:"Account"`
+	Arn     string `json:"Arn"`
+	UserID  string `json:"UserId"`
+}
+
+// whoami prints the identity of the named (else the current) profile.
+func (a *app) whoami(ctx context.Context, w io.Writer, args []string) error {
+	name := a.AWSProfile
+	if len(args) > 0 {
+		name = args[0]
+	}
+
+	return a.printCallerIdentity(ctx, w, name)
+}
+
+// printCallerIdentity resolves (refreshing, if needed) the profile and
+// prints the identity its credentials belong to.
+func (a *app) printCallerIdentity(ctx context.Context, w io.Writer, name string) (err error) {
+	c, err := a.resolveAndMaybeRefresh(ctx, name)
+	if err != nil {
+		return
+	}
+
+	out, err := a.mkSTSClient(c.provider()).GetCallerIdentity(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("get-caller-identity %s: %w", name, err)
+	}
+
+	id := callerIdentity{Account: aws.ToString(out.Account), Arn: aws.ToString(out.Arn), UserID: aws.ToString(out.UserId)}
+
+	return json.MarshalWrite(w, id, jsontext.WithIndent("  "))
+}
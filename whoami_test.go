@@ -0,0 +1,128 @@
+//nolint:lll // ok
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"github.com/zalando/go-keyring"
+)
+
+func newWhoamiApp(callerErr error) app {
+	return app{
+		store:  keyringStore{},
+		config: config{AWSProfile: "default"},
+		mkSTSClient: func(creds aws.CredentialsProvider) stsAPI {
+			return &mockSTSClient{
+				getCallerIDFunc: func(ctx context.Context, _ *sts.GetCallerIdentityInput, _ ...func(*sts.Options)) (*sts.GetCallerIdentityOutput, error) {
+					if callerErr != nil {
+						return nil, callerErr
+					}
+
+					cr, err := creds.Retrieve(ctx)
+					if err != nil {
+						return nil, err
+					}
+
+					return &sts.GetCallerIdentityOutput{
+						Account: aws.String("123456789012"),
+						Arn:     aws.String("arn:aws:iam::123456789012:user/" + cr.AccessKeyID),
+						UserId:  aws.String("AIDA" + cr.AccessKeyID),
+					}, nil
+				},
+			}
+		},
+	}
+}
+
+func TestAppWhoami(t *testing.T) {
+	tests := []struct {
+		callerErr error
+		name      string
+		want      string
+		wantErr   string
+		args      []string
+	}{
+		{
+			name: "current profile",
+			want: `"Arn": "arn:aws:iam::123456789012:user/AKIADEFAULT"`,
+		},
+		{
+			name: "named profile",
+			args: []string{"other"},
+			want: `"UserId": "AIDAAKIAOTHER"`,
+		},
+		{name: "missing profile", args: []string{"nope"}, wantErr: "not found"},
+		{name: "sts error", callerErr: errors.New("InvalidClientTokenId"), wantErr: "get-caller-identity default: Invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+			keyring.Set(keyringService, "default", `{"Version":1,"AccessKeyId":"AKIADEFAULT","SecretAccessKey":"s"}`) //nolint:errcheck,gosec // ok
+			keyring.Set(keyringService, "other", `{"Version":1,"AccessKeyId":"AKIAOTHER","SecretAccessKey":"s"}`)     //nolint:errcheck,gosec // ok
+
+			ap := newWhoamiApp(tt.callerErr)
+
+			var buf bytes.Buffer
+
+			err := ap.whoami(t.Context(), &buf, tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("whoami() error = %v, want %q", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil || !strings.Contains(buf.String(), tt.want) || !strings.Contains(buf.String(), `"Account": "123456789012"`) {
+				t.Errorf("whoami() = %s, %v, want %s", buf.String(), err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAppRunStoreVerify(t *testing.T) {
+	tests := []struct {
+		callerErr error
+		name      string
+		wantErr   string
+	}{
+		{name: "verified"},
+		{name: "not verified", callerErr: errors.New("InvalidClientTokenId"), wantErr: "stored, but verification failed"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keyring.MockInit()
+
+			ap := newWhoamiApp(tt.callerErr)
+			ap.prompt = func(label string, val *string) error {
+				switch label {
+				case "AccessKeyId":
+					*val = "AKIANEW"
+				case "SecretAccessKey":
+					*val = "s"
+				default:
+					return errors.New("skipped")
+				}
+
+				return nil
+			}
+
+			err := ap.run(t.Context(), []string{"awbus", "store", "--verify"})
+			if (tt.wantErr == "" && err != nil) || (tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr))) {
+				t.Errorf("run() error = %v, want %q", err, tt.wantErr)
+			}
+
+			if _, err = keyring.Get(keyringService, "default"); err != nil {
+				t.Errorf("profile not stored: %v", err)
+			}
+		})
+	}
+}